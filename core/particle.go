@@ -29,12 +29,20 @@ func (v Vector) MultiplyByScalar(scalar float64) *Vector {
 }
 
 type Particle struct {
+	ID        int     // Stable identity, unchanged as particles are added and removed
 	X, Y      float64 // Position
+	PrevX     float64 // Position at the start of the last step
+	PrevY     float64
 	Vx, Vy    float64 // Velocity
+	Radius    float64
+	Mass      float64
 	Density   float64
 	Pressure  float64
 	Force     Vector // Force
 	Neighbors []Particle
+	R, G, B   uint8   // Dye color, advected with the particle
+	Age       float64 // Time lived, counted only when MaxAge is set
+	MaxAge    float64 // Lifetime; the particle is removed once Age passes it, 0 lives forever
 }
 
 func CalculateDistance(p1, p2 Particle) float64 {
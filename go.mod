@@ -2,10 +2,11 @@ module fluids
 
 go 1.18
 
+require github.com/veandco/go-sdl2 v0.4.35
+
 require (
 	github.com/fogleman/gg v1.3.0 // indirect
 	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/veandco/go-sdl2 v0.4.35 // indirect
 	golang.org/x/image v0.13.0 // indirect
 )
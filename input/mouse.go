@@ -1,36 +1,46 @@
 package input
 
-import (
-	"fluids/simulation"
-	"math"
-)
+import "fluids/simulation"
 
+// radius of the mouse blast in simulation units
+const forceRadius = 10.0
+
+// radius of the gravity well's reach in simulation units, wider than the
+// blast so it gathers fluid from across a good part of the domain
+const wellRadius = 40.0
+
+// Blast is where a mouse blast went off, in simulation coordinates, and the
+// IDs of the particles it kicked.
+type Blast struct {
+	X, Y, Radius float64
+	Kicked       []int
+}
+
+// ApplyMouseForceToParticles converts the mouse position from window to
+// simulation coordinates and sets off a radial impulse there. When the domain
+// is letterboxed, the position and size are those of the domain's rectangle
+// in the window, with the mouse measured from its corner rather than the
+// window's.
 func ApplyMouseForceToParticles(
 	sim *simulation.FluidSim,
 	mouseX, mouseY, windowWidth, windowHeight int32,
 	mouseForce float64,
-) {
-	const forceRadius = 10.0
-	for i := range sim.Particles {
-		x_norm := float64(mouseX) / float64(windowWidth) * sim.Domain.X
-		y_norm := float64(mouseY) / float64(windowHeight) * sim.Domain.Y
-
-		dx := sim.Particles[i].X - x_norm
-		dy := sim.Particles[i].Y - y_norm
-
-		distanceSquared := dx*dx + dy*dy
-		if distanceSquared > forceRadius*forceRadius {
-			continue
-		}
-
-		length := math.Sqrt(distanceSquared)
-		if length == 0 {
-			continue
-		}
-		dx /= length
-		dy /= length
+) Blast {
+	x := float64(mouseX) / float64(windowWidth) * sim.Domain.X
+	y := float64(mouseY) / float64(windowHeight) * sim.Domain.Y
+	kicked := sim.ApplyRadialImpulse(x, y, mouseForce, forceRadius)
+	return Blast{X: x, Y: y, Radius: forceRadius, Kicked: kicked}
+}
 
-		sim.Particles[i].Vx += dx * mouseForce
-		sim.Particles[i].Vy += dy * mouseForce
-	}
+// ApplyGravityWell pulls the particles toward the mouse position for dt, as
+// ApplyMouseForceToParticles converts it. Called every step while the well
+// is held, it makes an attractor that follows the mouse.
+func ApplyGravityWell(
+	sim *simulation.FluidSim,
+	mouseX, mouseY, windowWidth, windowHeight int32,
+	strength, dt float64,
+) {
+	x := float64(mouseX) / float64(windowWidth) * sim.Domain.X
+	y := float64(mouseY) / float64(windowHeight) * sim.Domain.Y
+	sim.ApplyGravityWell(x, y, strength, wellRadius, dt)
 }
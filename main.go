@@ -4,8 +4,19 @@ import (
 	"flag"
 	"fluids/input"
 	"fluids/simulation"
+	"fluids/spatial"
+	"fluids/stream"
 	"fluids/viz"
+	"fmt"
+	"image/png"
+	"log"
+	"math"
 	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/veandco/go-sdl2/sdl"
@@ -13,16 +24,142 @@ import (
 
 const DEFAULT_GRAVITY = -100000.0
 
+// number of particles added or removed per key press
+const PARTICLE_BATCH = 500
+
+// side of the square block of fluid the w key drops at the cursor, in
+// simulation units
+const BLOCK_SIZE = 16.0
+
+// spray the j key throws from the cursor: particles per burst, their top
+// speed in simulation units per second, and how long they live in seconds
+const SPRAY_COUNT = 40
+const SPRAY_SPEED = 200.0
+const SPRAY_LIFETIME = 0.1
+
+// dye painting: brush radius in simulation units, per-frame diffusion rate,
+// and the colors successive right clicks cycle through
+const DYE_RADIUS = 8.0
+const DYE_DIFFUSION = 0.02
+
+// speed of the piston dropped with the p key when -piston isn't set
+const PISTON_SPEED = 20.0
+
+// how close, in pixels, a click in debug mode must be to select a particle
+const SELECT_PIXELS = 6.0
+
+// time scale limits for the - and = keys; fast-forward adds substeps rather
+// than lengthening them, so the cap bounds the extra work per frame
+const MIN_TIME_SCALE = 1.0 / 16
+const MAX_TIME_SCALE = 8.0
+
+// pixels per simulation unit in the -pressurePng image
+const PRESSURE_PNG_SCALE = 4
+
+// bins in the debug-mode speed histogram
+const HISTOGRAM_BINS = 24
+
+// frames the mouse blast overlay stays up after a click
+const BLAST_OVERLAY_FRAMES = 30
+
+// obstacle radius as a fraction of the domain height, for the wind tunnel
+const OBSTACLE_FRACTION = 1.0 / 8
+
+// interaction radius change per e or t key press, and its limits
+const RADIUS_STEP = 0.5
+const MIN_INTERACTION_RADIUS = 1.0
+const MAX_INTERACTION_RADIUS = 16.0
+
+// longest an idle window waits for input, in milliseconds, before looking
+// again; input arriving sooner wakes it at once
+const IDLE_WAIT_MS = 250
+
+var dyeColors = [][3]uint8{{230, 40, 40}, {40, 200, 60}, {60, 90, 240}, {240, 200, 30}}
+
+// newTunnelOrSim builds a wind tunnel when tunnelSpeed is set and a plain
+// sim otherwise.
+func newTunnelOrSim(n int, domain simulation.Domain, dt, rho0, nu, tunnelSpeed float64, obstacle bool) *simulation.FluidSim {
+	if tunnelSpeed == 0 {
+		return simulation.NewFluidSim(n, domain, dt, rho0, nu)
+	}
+	sim := simulation.NewWindTunnelScene(n, domain, dt, rho0, nu, tunnelSpeed)
+	if obstacle {
+		sim.Tunnel.Obstacle = domain.CenterObstacle(domain.Y * OBSTACLE_FRACTION)
+	}
+	return sim
+}
+
+// simOptions are the settings of a run that SimParameters doesn't hold: the
+// scene the particles start in and how the sim stores them.
+type simOptions struct {
+	n                int
+	domain           simulation.Domain
+	gridType         spatial.GridType
+	initialCondition simulation.InitialConditionFunc
+	velocityField    simulation.VelocityField
+	periodic         bool
+	pistonSpeed      float64 // 0 for no piston
+	tunnelSpeed      float64 // 0 for a plain sim instead of a wind tunnel
+	obstacle         bool
+	doubleBuffer     bool
+	sortNeighbors    bool
+	splashSpeed      float64
+}
+
+// buildSim builds the sim a run starts from, with params applied and its
+// initial placement relaxed. It draws from math/rand, so seed it first to
+// reproduce a layout.
+func buildSim(opts simOptions, params simulation.SimParameters) *simulation.FluidSim {
+	sim := newTunnelOrSim(opts.n, opts.domain, params.Dt, params.Rho0, params.Nu, opts.tunnelSpeed, opts.obstacle)
+	sim.SetGridType(opts.gridType)
+	sim.ApplyTunables(params)
+	sim.DoubleBuffer = opts.doubleBuffer
+	sim.SortNeighbors = opts.sortNeighbors
+	sim.SplashSpeed = opts.splashSpeed
+	if opts.periodic {
+		sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	}
+	if opts.pistonSpeed > 0 {
+		sim.Piston = &simulation.Piston{Velocity: opts.pistonSpeed}
+	}
+	if opts.initialCondition != nil {
+		sim.ApplyInitialCondition(opts.initialCondition)
+	}
+	sim.ApplyVelocityField(opts.velocityField)
+	sim.RelaxPacking(params.RelaxIterations)
+	return sim
+}
+
 func RunSimulation(
 	seed int64,
-	n int,
-	dt, rho0, nu, domainX, domainY, pressureMultiplier float64,
+	opts simOptions,
+	params simulation.SimParameters,
 	frameRate int64,
-	particleRadius, gravity, mouseForce float64,
+	particleRadius, wellStrength float64,
+	substeps int,
+	autoDt float64,
+	idleSpeed float64,
+	frameBudget time.Duration,
+	saveConfigPath string,
+	style viz.RenderStyle,
 ) {
-	domain := simulation.Domain{X: domainX, Y: domainY}
-
-	fluidSim := simulation.NewFluidSim(n, domain, dt, rho0, nu)
+	dt, gravity, pressureMultiplier, mouseForce := params.Dt, params.Gravity, params.PressureMultiplier, params.MouseForce
+	settleSteps := params.SettleSteps
+	// every new sim starts from seed, so a reset reproduces the same layout;
+	// resets keep the tuned step
+	newSim := func() *simulation.FluidSim {
+		rand.Seed(seed)
+		resetParams := params
+		resetParams.Dt = dt
+		return buildSim(opts, resetParams)
+	}
+	fluidSim := newSim()
+	fmt.Printf("running with -seed %d\n", seed)
+	if autoDt > 0 {
+		dt = fluidSim.AutoTuneDtWith(simulation.StepParams{Gravity: gravity, PressureMultiplier: pressureMultiplier}, autoDt)
+		fluidSim.Dt = dt
+		fmt.Printf("auto-tuned -dt %g\n", dt)
+	}
 
 	renderer, window, err := viz.NewWindow()
 	if err != nil {
@@ -30,23 +167,81 @@ func RunSimulation(
 	}
 
 	windowWidth, windowHeight := window.GetSize()
+	// the domain's rectangle in the window; overlays are drawn and mouse
+	// positions measured within it
+	view := sdl.Rect{W: windowWidth, H: windowHeight}
+	if style.Letterbox {
+		view = viz.Letterbox(windowWidth, windowHeight, fluidSim.Domain)
+	}
 
 	var mouseX, mouseY int32
 	running := true
 	paused := false
+	lastStatus := ""
+	colorScheme := viz.BlueWhite
+	schemeBeforeForce := colorScheme // restored when force coloring is toggled off
+	settleRemaining := settleSteps
+	debug := false
+	timeScale := 1.0
+	selectedID := -1 // particle inspected in debug mode, -1 for none
+	cellLabels := false
+	wellHeld := false
+	escapeWarned := false
+	gridEscapes := 0
+	var splashes viz.SplashEffects
+	// with -idle, set once the fluid has settled so the loop waits for input
+	// instead of stepping a fluid that isn't moving; any input clears it
+	asleep := false
+	// with -frameBudget, set when the last frame's physics ran past the
+	// budget, which drops the rest of its substeps and the debug statistics;
+	// the substeps it ran and had planned are shown in the title
+	overBudget := false
+	doneSubsteps, plannedSubsteps := 0, 0
+
+	// mouse blast overlay, toggled with b: the last blast and frames left to show it
+	blastOverlay := false
+	var lastBlast input.Blast
+	blastFrames := 0
+	dyeIndex := 0
+
+	// flux measurement line, placed with shift-click-drag
+	var fluxX1, fluxY1, fluxX2, fluxY2, flux float64
+	fluxLine, fluxDragging := false, false
+
+	toSim := func(x, y int32) (float64, float64) {
+		return float64(x) / float64(view.W) * fluidSim.Domain.X,
+			float64(y) / float64(view.H) * fluidSim.Domain.Y
+	}
 
 	originalGravity := gravity
 	defaultGravity := DEFAULT_GRAVITY // Default gravity value
 
 	for running {
+		// an idle loop blocks on the event queue rather than polling and
+		// sleeping, so it costs no CPU but still wakes as soon as input arrives
+		idle := idleSpeed > 0 && (paused || asleep)
+		event := sdl.PollEvent()
+		if event == nil && idle {
+			event = sdl.WaitEventTimeout(IDLE_WAIT_MS)
+		}
+
 		// handle SDL Events
-		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		for ; event != nil; event = sdl.PollEvent() {
+			asleep = false
 			switch e := event.(type) {
 			case *sdl.QuitEvent:
 				running = false
 			case *sdl.MouseMotionEvent:
-				mouseX, mouseY = e.X, e.Y
+				mouseX, mouseY = e.X-view.X, e.Y-view.Y
+				if fluxDragging {
+					fluxX2, fluxY2 = toSim(mouseX, mouseY)
+				}
 			case *sdl.KeyboardEvent:
+				if e.Keysym.Sym == sdl.K_q {
+					// 'q' key holds a gravity well at the cursor; it is held
+					// rather than toggled, so letting go always removes it
+					wellHeld = e.Type == sdl.KEYDOWN
+				}
 				if e.Type == sdl.KEYDOWN {
 					switch e.Keysym.Sym {
 					case sdl.K_g: // 'g' key to toggle gravity
@@ -59,22 +254,189 @@ func RunSimulation(
 								gravity = originalGravity
 							}
 						}
-					case sdl.K_r: // 'R' key to reset the simulation
-						fluidSim = simulation.NewFluidSim(n, domain, dt, rho0, nu)
+					case sdl.K_i: // 'i' key to flip gravity upside down
+						gravity = -gravity
+					case sdl.K_z: // 'z' key for zero-G; g brings back the configured gravity
+						gravity = 0
+					case sdl.K_r: // 'R' key to reset the simulation to the same starting layout
+						fluidSim = newSim()
+						settleRemaining = settleSteps
+					case sdl.K_n: // 'n' key to restart from a fresh random layout, keeping tuned parameters
+						seed = time.Now().UnixNano()
+						fmt.Printf("restarted with -seed %d\n", seed)
+						fluidSim = newSim()
+						settleRemaining = settleSteps
+					case sdl.K_0: // '0' key to restore default parameters, keeping particle positions
+						defaults := simulation.GetDefaultSimParameters()
+						gravity = defaults.Gravity
+						pressureMultiplier = defaults.PressureMultiplier
+						mouseForce = defaults.MouseForce
+						// sand stays sand
+						defaults.Material = fluidSim.Material
+						defaults.CorrectPressureForce = fluidSim.CorrectPressureForce
+						defaults.CorrectViscosityForce = fluidSim.CorrectViscosityForce
+						defaults.NoDensityRepulsion = fluidSim.NoDensityRepulsion
+						defaults.AutoRecenter = fluidSim.AutoRecenter
+						defaults.DivergenceFree = fluidSim.DivergenceFree
+						// particles keep their radii and masses
+						defaults.RadiusBase, defaults.RadiusVariation = fluidSim.RadiusBase, fluidSim.RadiusVariation
+						fluidSim.ApplyTunables(defaults)
+					case sdl.K_LEFTBRACKET: // '[' key for fewer substeps per frame
+						if substeps > 1 {
+							substeps--
+						}
+					case sdl.K_RIGHTBRACKET: // ']' key for more substeps per frame
+						substeps++
+					case sdl.K_MINUS: // '-' key for slower motion
+						timeScale = math.Max(timeScale/2, MIN_TIME_SCALE)
+					case sdl.K_EQUALS: // '=' key for faster motion
+						timeScale = math.Min(timeScale*2, MAX_TIME_SCALE)
+					case sdl.K_c: // 'c' key to cycle color schemes
+						colorScheme = colorScheme.Next()
+					case sdl.K_b: // 'b' key to toggle the mouse blast overlay
+						blastOverlay = !blastOverlay
+					case sdl.K_f: // 'f' key to toggle coloring by force magnitude
+						if colorScheme == viz.Force {
+							colorScheme = schemeBeforeForce
+						} else {
+							schemeBeforeForce, colorScheme = colorScheme, viz.Force
+						}
+					case sdl.K_PERIOD: // '.' key to add particles
+						fluidSim.AddParticles(PARTICLE_BATCH)
+					case sdl.K_COMMA: // ',' key to remove particles
+						fluidSim.RemoveParticles(PARTICLE_BATCH)
+					case sdl.K_w: // 'w' key to drop a block of water at the cursor
+						// at the fluid's mean spacing, so the block is no denser than the rest
+						x, y := toSim(mouseX, mouseY)
+						fluidSim.AddBlock(x-BLOCK_SIZE/2, y-BLOCK_SIZE/2, BLOCK_SIZE, BLOCK_SIZE, fluidSim.PackingSpacing())
+					case sdl.K_j: // 'j' key to throw a burst of short-lived spray from the cursor
+						x, y := toSim(mouseX, mouseY)
+						fluidSim.EmitSpray(x, y, SPRAY_COUNT, SPRAY_SPEED, SPRAY_LIFETIME)
+					case sdl.K_e: // 'e' key to shrink the interaction radius
+						if r := fluidSim.InteractionRadius - RADIUS_STEP; r >= MIN_INTERACTION_RADIUS {
+							fluidSim.SetInteractionRadius(r)
+						}
+					case sdl.K_t: // 't' key to grow the interaction radius
+						if r := fluidSim.InteractionRadius + RADIUS_STEP; r <= MAX_INTERACTION_RADIUS {
+							fluidSim.SetInteractionRadius(r)
+						}
+					case sdl.K_x: // 'x' key to save the current parameters for -config
+						live := fluidSim.Tunables(params)
+						live.Dt, live.Gravity, live.PressureMultiplier, live.MouseForce = dt, gravity, pressureMultiplier, mouseForce
+						if err := simulation.SaveParams(saveConfigPath, live); err != nil {
+							log.Printf("saving parameters: %v", err)
+						} else {
+							fmt.Printf("saved parameters to %s; load them with -config %s\n", saveConfigPath, saveConfigPath)
+						}
+					case sdl.K_k: // 'k' key to kill all motion
+						fluidSim.Freeze()
+					case sdl.K_a: // 'a' key to toggle additive (glowing) particle blending
+						style.Additive = !style.Additive
+					case sdl.K_h: // 'h' key to toggle fading sparse particles by density
+						style.DensityAlpha = !style.DensityAlpha
+					case sdl.K_m: // 'm' key to toggle the neighbor mesh
+						style.NeighborMesh = !style.NeighborMesh
+					case sdl.K_l: // 'l' key to toggle the hovered grid cell's statistics
+						cellLabels = !cellLabels
+					case sdl.K_s: // 's' key to toggle pressure-scaled particle sizes
+						style.PressureSize = !style.PressureSize
+					case sdl.K_p: // 'p' key to drop a piston from the top, or lift it away
+						if fluidSim.Piston != nil {
+							fluidSim.Piston = nil
+						} else if opts.pistonSpeed > 0 {
+							fluidSim.Piston = &simulation.Piston{Velocity: opts.pistonSpeed}
+						} else {
+							fluidSim.Piston = &simulation.Piston{Velocity: PISTON_SPEED}
+						}
+					case sdl.K_o: // 'o' key to drop an obstacle into the wind tunnel, or remove it
+						if fluidSim.Tunnel != nil {
+							if fluidSim.Tunnel.Obstacle != nil {
+								fluidSim.Tunnel.Obstacle = nil
+							} else {
+								fluidSim.Tunnel.Obstacle = fluidSim.Domain.CenterObstacle(fluidSim.Domain.Y * OBSTACLE_FRACTION)
+							}
+						}
+					case sdl.K_d: // 'd' key to toggle debug overlays
+						debug = !debug
 					case sdl.K_SPACE: // Space key to pause/unpause
 						paused = !paused
 					}
 				}
 			case *sdl.MouseButtonEvent:
-				if e.Type == sdl.MOUSEBUTTONDOWN {
-					if e.Button == sdl.BUTTON_LEFT {
-						input.ApplyMouseForceToParticles(fluidSim, mouseX, mouseY, windowWidth, windowHeight, mouseForce)
+				if e.Type == sdl.MOUSEBUTTONUP && e.Button == sdl.BUTTON_LEFT && fluxDragging {
+					fluxDragging = false
+					fluxLine = true
+					flux = 0
+				}
+				if e.Type == sdl.MOUSEBUTTONDOWN && settleRemaining == 0 {
+					if e.Button == sdl.BUTTON_LEFT && sdl.GetModState()&sdl.KMOD_SHIFT != 0 {
+						fluxX1, fluxY1 = toSim(mouseX, mouseY)
+						fluxX2, fluxY2 = fluxX1, fluxY1
+						fluxDragging = true
+						fluxLine = false
+					} else if e.Button == sdl.BUTTON_LEFT && debug {
+						// in debug mode clicking selects a particle to inspect
+						x, y := toSim(mouseX, mouseY)
+						selectedID = -1
+						if i := fluidSim.NearestParticle(x, y, SELECT_PIXELS*fluidSim.Domain.X/float64(view.W)); i >= 0 {
+							selectedID = fluidSim.Particles[i].ID
+						}
+					} else if e.Button == sdl.BUTTON_LEFT {
+						lastBlast = input.ApplyMouseForceToParticles(fluidSim, mouseX, mouseY, view.W, view.H, mouseForce)
+						blastFrames = BLAST_OVERLAY_FRAMES
+					} else if e.Button == sdl.BUTTON_RIGHT {
+						// paint dye and switch to the dye view so it's visible
+						c := dyeColors[dyeIndex%len(dyeColors)]
+						x, y := toSim(mouseX, mouseY)
+						fluidSim.PaintDye(x, y, DYE_RADIUS, c[0], c[1], c[2])
+						dyeIndex++
+						colorScheme = viz.Dye
 					}
 				}
 			}
 		}
-		if !paused {
-			meanPressure, stdPressure := fluidSim.Step(gravity, pressureMultiplier, dt)
+		overBudget = false
+		if !paused && !asleep {
+			if settleRemaining > 0 {
+				// quiet start: relax the initial placement before interaction begins
+				fluidSim.SettleStep(pressureMultiplier, dt)
+				settleRemaining--
+			} else {
+				// each frame advances the simulation by dt * timeScale in total,
+				// split into substeps no longer than dt/substeps so fast-forward
+				// stays as stable as real time; statistics are computed once per frame
+				frameSubsteps := substeps * int(math.Ceil(timeScale))
+				frameStart := time.Now()
+				plannedSubsteps, doneSubsteps = frameSubsteps, 0
+				for doneSubsteps < frameSubsteps {
+					if wellHeld {
+						input.ApplyGravityWell(fluidSim, mouseX, mouseY, view.W, view.H, wellStrength, dt*timeScale/float64(frameSubsteps))
+					}
+					fluidSim.Advance(gravity, pressureMultiplier, dt*timeScale/float64(frameSubsteps))
+					if fluxLine {
+						flux += fluidSim.FluxAcross(fluxX1, fluxY1, fluxX2, fluxY2)
+					}
+					splashes.Add(fluidSim.Splashes)
+					doneSubsteps++
+					// keep the window system answered between heavy steps, and
+					// once over budget leave the rest of the frame's substeps
+					// so input is handled again promptly; the fluid runs in
+					// slow motion rather than the window hanging
+					sdl.PumpEvents()
+					if frameBudget > 0 && time.Since(frameStart) > frameBudget {
+						overBudget = true
+						break
+					}
+				}
+				warnIfEscaped(fluidSim, &escapeWarned)
+				logGridEscapes(fluidSim, &gridEscapes)
+				asleep = idleSpeed > 0 && !wellHeld && fluidSim.IsSettled(idleSpeed)
+			}
+			if colorScheme == viz.Dye {
+				fluidSim.DiffuseDye(DYE_DIFFUSION)
+			}
+			meanPressure, stdPressure := fluidSim.CalculatePressureStats()
+			renderer.SetViewport(nil)
 			viz.RenderFrame(
 				renderer,
 				fluidSim.Particles,
@@ -84,15 +446,451 @@ func RunSimulation(
 				particleRadius,
 				meanPressure,
 				stdPressure,
+				colorScheme,
+				style,
 			)
+			splashes.Render(renderer, fluidSim.Domain, view.W, view.H)
+			if blastOverlay && blastFrames > 0 {
+				viz.RenderBlast(renderer, fluidSim.Particles, fluidSim.Domain, view.W, view.H,
+					lastBlast.X, lastBlast.Y, lastBlast.Radius, lastBlast.Kicked, particleRadius)
+				blastFrames--
+			}
+			if debug {
+				viz.RenderGrid(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Grid.GetCellSize())
+				viz.RenderKernelSupport(renderer, fluidSim, mouseX, mouseY, view.W, view.H, particleRadius)
+				if !overBudget {
+					viz.RenderHistogram(renderer, view.W, view.H, fluidSim.SpeedHistogram(HISTOGRAM_BINS, 0))
+				}
+				if i := fluidSim.IndexOfID(selectedID); i >= 0 {
+					viz.RenderSelection(renderer, fluidSim.Domain, view.W, view.H, &fluidSim.Particles[i], particleRadius)
+				}
+			}
+			if cellLabels {
+				cellX, cellY := fluidSim.Grid.CellOf(toSim(mouseX, mouseY))
+				viz.RenderCell(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Grid.GetCellSize(), cellX, cellY)
+			}
+			if fluidSim.Piston != nil {
+				viz.RenderPiston(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Piston)
+			}
+			if fluidSim.Tunnel != nil && fluidSim.Tunnel.Obstacle != nil {
+				viz.RenderObstacle(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Tunnel.Obstacle)
+			}
+			if fluxLine || fluxDragging {
+				viz.RenderSegment(renderer, fluidSim.Domain, view.W, view.H, fluxX1, fluxY1, fluxX2, fluxY2)
+			}
+			renderer.Present()
+		}
+
+		status := fmt.Sprintf("particles %d | substeps %d | gravity %g | colors %s", fluidSim.N, substeps, gravity, colorScheme)
+		if timeScale != 1 {
+			status = fmt.Sprintf("%s | time x%g", status, timeScale)
+		}
+		if fluidSim.InteractionRadius != spatial.SMOOTHING_RADIUS {
+			status = fmt.Sprintf("%s | radius %g", status, fluidSim.InteractionRadius)
+		}
+		if wellHeld {
+			status = fmt.Sprintf("%s | gravity well", status)
+		}
+		if fluxLine {
+			status = fmt.Sprintf("%s | flux %.1f", status, flux)
+		}
+		if fluidSim.EscapedFraction > 0 {
+			escaped := int(math.Round(fluidSim.EscapedFraction * float64(len(fluidSim.Particles))))
+			status = fmt.Sprintf("%s | escaped %d (%.1f%%)", status, escaped, 100*fluidSim.EscapedFraction)
+		}
+		if overBudget {
+			status = fmt.Sprintf("%s | over frame budget: %d of %d substeps", status, doneSubsteps, plannedSubsteps)
+		}
+		if debug {
+			status = fmt.Sprintf("%s | solver iterations %d", status, fluidSim.Iterations)
+			if _, peak, at := simulation.ForceStats(fluidSim.Particles); at >= 0 && !overBudget {
+				p := &fluidSim.Particles[at]
+				status = fmt.Sprintf("%s | peak force %.3g at (%.1f, %.1f)", status, peak, p.X, p.Y)
+			}
+		}
+		if cellLabels {
+			x, y := toSim(mouseX, mouseY)
+			cellX, cellY := fluidSim.Grid.CellOf(x, y)
+			if n, rho, p := fluidSim.CellStats(x, y); n > 0 {
+				status = fmt.Sprintf("%s | cell (%d, %d) %d particles rho %.3f p %.1f", status, cellX, cellY, n, rho, p)
+			} else {
+				status = fmt.Sprintf("%s | cell (%d, %d) empty", status, cellX, cellY)
+			}
+		}
+		if i := fluidSim.IndexOfID(selectedID); debug && i >= 0 {
+			p := &fluidSim.Particles[i]
+			status = fmt.Sprintf("%s | #%d pos (%.2f, %.2f) vel (%.2f, %.2f) rho %.3f p %.1f neighbors %d force (%.1f, %.1f)",
+				status, p.ID, p.X, p.Y, p.Vx, p.Vy, p.Density, p.Pressure, len(p.Neighbors), p.Force.X, p.Force.Y)
+		}
+		if settleRemaining > 0 {
+			status = fmt.Sprintf("settling... %d steps left | %s", settleRemaining, status)
+		}
+		if status != lastStatus {
+			viz.SetStatus(window, status)
+			lastStatus = status
 		}
 
 		// we interpret frameRate as frames per second
-		// so we need to sleep for 1/frameRate seconds
+		// so we need to sleep for 1/frameRate seconds; an idle loop was
+		// already paced by waiting for events, and a frame over budget has
+		// no time to spare
+		if !idle && !overBudget {
+			time.Sleep(time.Duration(1e9 / frameRate))
+		}
+	}
+}
+
+// RunServer steps the simulation at the given frame rate and streams each
+// frame to any browsers connected at addr. With nobody watching it keeps
+// stepping but skips encoding.
+func RunServer(
+	fluidSim *simulation.FluidSim,
+	addr string,
+	frameRate int64,
+	substeps int,
+	gravity, pressureMultiplier, dt float64,
+) {
+	server := stream.NewServer()
+	go func() {
+		log.Fatal(http.ListenAndServe(addr, server.Handler()))
+	}()
+	log.Printf("serving simulation at http://%s", displayAddr(addr))
+
+	ticker := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer ticker.Stop()
+	subDt := dt / float64(substeps)
+	for range ticker.C {
+		for s := 0; s < substeps; s++ {
+			fluidSim.Advance(gravity, pressureMultiplier, subDt)
+		}
+		if server.HasClients() {
+			meanPressure, stdPressure := fluidSim.CalculatePressureStats()
+			server.Broadcast(fluidSim.Particles, fluidSim.Domain, meanPressure, stdPressure)
+		}
+	}
+}
+
+// displayAddr turns a listen address like ":8080" into something a browser
+// can open.
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// warnIfEscaped logs a warning each time the fraction of particles outside
+// the domain rises past the sim's escape threshold, so a blow-up that empties
+// the window is reported rather than leaving it mysteriously blank.
+func warnIfEscaped(sim *simulation.FluidSim, warned *bool) {
+	escaping := sim.EscapedFraction > sim.EscapeThreshold
+	if escaping && !*warned {
+		hint := "try a smaller -dt, or -recenter to pull it back"
+		if sim.AutoRecenter {
+			hint = "recentering"
+		}
+		log.Printf("warning: %.0f%% of particles have left the domain; %s", 100*sim.EscapedFraction, hint)
+	}
+	*warned = escaping
+}
+
+// logGridEscapes logs the number of particles the neighbor grid had to clamp
+// into its edge cells each time it reaches a new high, so a run without a
+// window still hears about particles leaving the domain. peak holds the
+// highest count logged so far.
+func logGridEscapes(sim *simulation.FluidSim, peak *int) {
+	grid, ok := sim.Grid.(*spatial.Grid)
+	if !ok || grid.Escaped <= *peak {
+		return
+	}
+	*peak = grid.Escaped
+	log.Printf("grid: %d particles outside the domain filed under its edge cells", grid.Escaped)
+}
+
+// RunHeadless steps the simulation without opening a window, optionally
+// writing per-step statistics as JSON lines. A positive settledSpeed stops
+// the run early once the fluid has settled at that mean speed. afterStep, if
+// set, is called after every step with the step's pressure statistics; it
+// isn't timed.
+func RunHeadless(
+	fluidSim *simulation.FluidSim,
+	steps int,
+	gravity, pressureMultiplier, dt float64,
+	stats *simulation.StatsWriter,
+	settledSpeed float64,
+	afterStep func(step int, meanPressure, stdPressure float64) error,
+) {
+	// only the steps themselves are timed, not setup or writing statistics
+	var simulated time.Duration
+	ran, settled := steps, false
+	escapeWarned := false
+	gridEscapes := 0
+	report := simulation.NewRunReport(fluidSim, gravity)
+	for step := 0; step < steps; step++ {
+		start := time.Now()
+		meanPressure, stdPressure := fluidSim.Step(gravity, pressureMultiplier, dt)
+		elapsed := time.Since(start)
+		simulated += elapsed
+		report.Record(fluidSim)
+		warnIfEscaped(fluidSim, &escapeWarned)
+		logGridEscapes(fluidSim, &gridEscapes)
+		if stats != nil {
+			if err := stats.Write(fluidSim.ComputeStepStats(step, meanPressure, stdPressure, elapsed)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if afterStep != nil {
+			if err := afterStep(step, meanPressure, stdPressure); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if settledSpeed > 0 && fluidSim.IsSettled(settledSpeed) {
+			ran, settled = step+1, true
+			break
+		}
+	}
+	if settledSpeed > 0 {
+		if settled {
+			fmt.Printf("settled after %d steps (t = %g)\n", ran, float64(ran)*dt)
+		} else {
+			fmt.Printf("not settled after %d steps\n", steps)
+		}
+	}
+	if stats != nil {
+		if err := stats.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("%d particles x %d steps in %.2fs: %.0f particle-steps/sec\n",
+		len(fluidSim.Particles), ran, simulated.Seconds(), fluidSim.Throughput(ran, simulated))
+	if err := report.Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// RunSideBySide runs one sim per value of a sweep, all from the same seed,
+// and draws each in its own column of one window. The sims step concurrently,
+// each with an equal share of the default workers. Space pauses.
+func RunSideBySide(cfg simulation.SweepConfig, frameRate int64, particleRadius float64, style viz.RenderStyle) {
+	values := cfg.Values()
+	sims := make([]*simulation.FluidSim, len(values))
+	params := make([]simulation.SimParameters, len(values))
+	labels := make([]string, len(values))
+	parallel := simulation.DefaultParallelConfig()
+	parallel.NumWorkers /= len(values)
+	if parallel.NumWorkers < 1 {
+		parallel.NumWorkers = 1
+	}
+	for k, value := range values {
+		sim, p, err := cfg.NewSim(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sim.Parallel = parallel
+		sims[k], params[k] = sim, p
+		labels[k] = fmt.Sprintf("%s %g", cfg.Param, value)
+	}
+
+	renderer, window, err := viz.NewWindow()
+	if err != nil {
+		panic(err)
+	}
+	viz.SetStatus(window, strings.Join(labels, " | "))
+	windowWidth, windowHeight := window.GetSize()
+	columnWidth := windowWidth / int32(len(sims))
+
+	running, paused := true, false
+	for running {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch e := event.(type) {
+			case *sdl.QuitEvent:
+				running = false
+			case *sdl.KeyboardEvent:
+				if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_SPACE {
+					paused = !paused
+				}
+			}
+		}
+		if paused {
+			time.Sleep(time.Duration(1e9 / frameRate))
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for k := range sims {
+			wg.Add(1)
+			go func(sim *simulation.FluidSim, p simulation.SimParameters) {
+				defer wg.Done()
+				sim.Advance(p.Gravity, p.PressureMultiplier, p.Dt)
+			}(sims[k], params[k])
+		}
+		wg.Wait()
+
+		for k, sim := range sims {
+			renderer.SetViewport(&sdl.Rect{X: int32(k) * columnWidth, Y: 0, W: columnWidth, H: windowHeight})
+			meanPressure, stdPressure := sim.CalculatePressureStats()
+			viz.RenderFrame(renderer, sim.Particles, sim.Domain, columnWidth, windowHeight,
+				particleRadius, meanPressure, stdPressure, viz.BlueWhite, style)
+		}
+		renderer.SetViewport(nil)
+		renderer.SetDrawColor(90, 90, 90, 255)
+		for k := 1; k < len(sims); k++ {
+			renderer.DrawLine(int32(k)*columnWidth, 0, int32(k)*columnWidth, windowHeight)
+		}
+		renderer.Present()
+
 		time.Sleep(time.Duration(1e9 / frameRate))
 	}
 }
 
+// RunOffscreen runs the simulation through RunHeadless, with its statistics
+// and settling check, and renders every frameEvery-th step with the software
+// renderer, through the same RenderFrame the window uses, saving it to dir as
+// frame_NNNNN.png numbered by step. It needs no display or GPU.
+func RunOffscreen(
+	fluidSim *simulation.FluidSim,
+	steps, frameEvery int,
+	dir string,
+	gravity, pressureMultiplier, dt, particleRadius float64,
+	stats *simulation.StatsWriter,
+	settledSpeed float64,
+	style viz.RenderStyle,
+) error {
+	if frameEvery < 1 {
+		frameEvery = 1
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	renderer, surface, err := viz.NewOffscreen(viz.WindowWidth, viz.WindowHeight)
+	if err != nil {
+		return err
+	}
+	defer surface.Free()
+	defer renderer.Destroy()
+
+	view := sdl.Rect{W: viz.WindowWidth, H: viz.WindowHeight}
+	if style.Letterbox {
+		view = viz.Letterbox(viz.WindowWidth, viz.WindowHeight, fluidSim.Domain)
+	}
+
+	frames := 0
+	RunHeadless(fluidSim, steps, gravity, pressureMultiplier, dt, stats, settledSpeed, func(step int, meanPressure, stdPressure float64) error {
+		if step%frameEvery != 0 {
+			return nil
+		}
+		renderer.SetViewport(nil)
+		viz.RenderFrame(renderer, fluidSim.Particles, fluidSim.Domain, viz.WindowWidth, viz.WindowHeight,
+			particleRadius, meanPressure, stdPressure, viz.BlueWhite, style)
+		if fluidSim.Piston != nil {
+			viz.RenderPiston(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Piston)
+		}
+		if fluidSim.Tunnel != nil && fluidSim.Tunnel.Obstacle != nil {
+			viz.RenderObstacle(renderer, fluidSim.Domain, view.W, view.H, fluidSim.Tunnel.Obstacle)
+		}
+		renderer.Present()
+		if err := viz.SaveSurfacePNG(surface, filepath.Join(dir, fmt.Sprintf("frame_%05d.png", step))); err != nil {
+			return err
+		}
+		frames++
+		return nil
+	})
+	fmt.Printf("wrote %d frames to %s\n", frames, dir)
+	return nil
+}
+
+// recordState writes the final particle state as a golden CSV.
+func recordState(path string, fluidSim *simulation.FluidSim) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := simulation.WriteStateCSV(f, fluidSim.Particles); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeGraph writes the neighbor graph as an edge list.
+func writeGraph(path string, fluidSim *simulation.FluidSim) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fluidSim.WriteNeighborGraph(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writePressurePng writes the pressure field as a grayscale PNG.
+func writePressurePng(path string, fluidSim *simulation.FluidSim) error {
+	img := simulation.RenderPressureField(fluidSim,
+		int(fluidSim.Domain.X*PRESSURE_PNG_SCALE), int(fluidSim.Domain.Y*PRESSURE_PNG_SCALE))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compareState diffs the particle state against a golden CSV, reports the
+// particles that diverged most, and returns whether both differences are
+// within tolerance.
+func compareState(path string, fluidSim *simulation.FluidSim, tolerance float64) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	golden, err := simulation.ReadStateCSV(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("reading %s: %v", path, err)
+	}
+	if len(golden) != len(fluidSim.Particles) {
+		fmt.Printf("FAIL: %d particles, golden has %d\n", len(fluidSim.Particles), len(golden))
+		return false
+	}
+	c := simulation.CompareParticles(fluidSim.Particles, golden)
+	ok := c.MaxPosDiff <= tolerance && c.MaxVelDiff <= tolerance
+	result := "ok"
+	if !ok {
+		result = "FAIL"
+	}
+	fmt.Printf("%s: max position diff %g (particle %d), max velocity diff %g (particle %d)\n",
+		result, c.MaxPosDiff, c.PosIndex, c.MaxVelDiff, c.VelIndex)
+	return ok
+}
+
+// configFlag finds the value of -config among the arguments before the
+// flags are parsed, since the file it names supplies the other flags'
+// defaults.
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		// flags may start with one dash or two
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
 func main() {
 	var (
 		n                  int
@@ -102,39 +900,345 @@ func main() {
 		nu                 float64
 		domainX            float64
 		domainY            float64
+		circle             bool
 		pressureMultiplier float64
 		frameRate          int64
 		gravity            float64
 		mouseForce         float64
+		wellStrength       float64
+		hashGrid           bool
+		headless           bool
+		steps              int
+		settledSpeed       float64
+		offscreenDir       string
+		sweepSpec          string
+		sideBySideSpec     string
+		frameEvery         int
+		statsPath          string
+		serveAddr          string
+		seed               int64
+		recordPath         string
+		graphPath          string
+		pressurePngPath    string
+		comparePath        string
+		tolerance          float64
+		background         string
+		additive           bool
+		densityAlpha       bool
+		mesh               bool
+		neighborSkin       float64
+		neighborDrawLimit  int
+		substeps           int
+		settleSteps        int
+		relaxIterations    int
+		maskPath           string
+		damBreak           bool
+		jitter             float64
+		radiusVariation    float64
+		divergenceFree     bool
+		restitution        float64
+		pistonSpeed        float64
+		maxSpeed           float64
+		adhesion           float64
+		friction           float64
+		restThreshold      float64
+		maxNeighbors       int
+		taylorGreen        float64
+		shear              float64
+		vortex             float64
+		tunnelSpeed        float64
+		obstacle           bool
+		autoDt             float64
+		granular           bool
+		recenter           bool
+		minDistance        float64
+		densityRadius      float64
+		doubleBuffer       bool
+		splashSpeed        float64
+		sortNeighbors      bool
+		idleSpeed          float64
+		frameBudgetMs      float64
+		stretch            bool
+		correctPressure    bool
+		correctViscosity   bool
+		noRepulsion        bool
+		configPath         string
+		saveConfigPath     string
 	)
 
+	// a -config file replaces the defaults, so flags given alongside it
+	// still override what it sets
+	defaults := simulation.GetDefaultSimParameters()
+	if path := configFlag(os.Args[1:]); path != "" {
+		loaded, err := simulation.LoadParams(path, defaults)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defaults = loaded
+	}
+
+	flag.StringVar(&configPath, "config", "", "JSON file of parameters, as saved with the x key, to start from; other flags override it")
+	flag.StringVar(&saveConfigPath, "saveConfig", "fluids.json", "File the x key saves the current parameters to, for loading with -config")
 	flag.IntVar(&n, "n", 500, "Number of particles")
-	flag.Float64Var(&dt, "dt", 0.0005, "Time step")
-	flag.Float64Var(&rho0, "rho0", 1.0, "Reference density")
-	flag.Float64Var(&nu, "nu", 1.0, "Viscosity")
+	flag.Float64Var(&dt, "dt", defaults.Dt, "Time step")
+	flag.Float64Var(&rho0, "rho0", defaults.Rho0, "Reference density")
+	flag.Float64Var(&nu, "nu", defaults.Nu, "Viscosity")
 	flag.Float64Var(&domainX, "domainX", 100.0, "Domain X size")
 	flag.Float64Var(&domainY, "domainY", 100.0, "Domain Y size")
-	flag.Float64Var(&pressureMultiplier, "pressure", 10000.0, "Pressure multiplier")
+	flag.BoolVar(&circle, "circle", false, "Use a circular tank inscribed in the domain box")
+	flag.Float64Var(&autoDt, "autodt", 0, "Pick the time step automatically, allowing the density error to grow by at most this much over a short trial; 0 to use -dt")
+	flag.Float64Var(&pressureMultiplier, "pressure", defaults.PressureMultiplier, "Pressure multiplier")
 	flag.Int64Var(&frameRate, "fps", 480, "Frame rate")
 	flag.Float64Var(&particleRadius, "radius", 2.4, "Particle radius")
-	flag.Float64Var(&gravity, "g", 0, "Gravity")
-	flag.Float64Var(&mouseForce, "boom", 100.0, "Mouse force")
+	flag.Float64Var(&gravity, "g", defaults.Gravity, "Gravity")
+	flag.Float64Var(&mouseForce, "boom", defaults.MouseForce, "Mouse force")
+	flag.Float64Var(&wellStrength, "well", 1e7, "Strength of the gravity well held at the cursor with q: the pull is this over the squared distance")
+	flag.BoolVar(&doubleBuffer, "doublebuffer", false, "Integrate into a shadow copy of the particles and swap it in, instead of updating in place")
+	flag.BoolVar(&sortNeighbors, "sortNeighbors", false, "Sort neighbor lists by particle index so results don't depend on the grid's cell layout")
+	flag.BoolVar(&stretch, "stretch", false, "Stretch the domain to fill the window instead of letterboxing it to keep its aspect ratio")
+	flag.Float64Var(&idleSpeed, "idle", 0, "Wait for input instead of stepping while paused or once the fluid has settled below this mean speed; 0 to always run")
+	flag.Float64Var(&frameBudgetMs, "frameBudget", 0, "Longest a frame's physics may run, in milliseconds, before its remaining substeps are dropped to keep the window responsive; 0 for no limit")
+	flag.BoolVar(&hashGrid, "hashgrid", false, "Use the hashed grid for neighbor search (sparse domains)")
+	flag.IntVar(&substeps, "substeps", 1, "Physics substeps per frame; each frame advances dt in total")
+	flag.IntVar(&settleSteps, "settle", defaults.SettleSteps, "Steps to relax the initial placement (no gravity, heavy drag) before the run")
+	flag.IntVar(&relaxIterations, "relax", defaults.RelaxIterations, "Iterations of repulsion-only packing relaxation applied to the initial placement")
+	flag.Float64Var(&radiusVariation, "radiusVariation", defaults.RadiusVariation, "Spread of particle radii as a fraction of the base radius; 0 for identical particles")
+	flag.BoolVar(&divergenceFree, "divfree", defaults.DivergenceFree, "Project velocities toward zero divergence each step")
+	flag.Float64Var(&restitution, "restitution", defaults.Restitution, "Fraction of normal velocity kept when bouncing off a wall; 1 is elastic")
+	flag.Float64Var(&maxSpeed, "maxSpeed", defaults.MaxSpeed, "Clamp particle speeds to this; 0 for unlimited")
+	flag.Float64Var(&adhesion, "adhesion", defaults.Adhesion, "Wall attraction per unit density; positive wets the walls, negative beads away")
+	flag.Float64Var(&friction, "friction", defaults.Friction, "Fraction of sliding velocity touching particles lose each step, 0 to 1; high values make particles clump together")
+	flag.Float64Var(&densityRadius, "densityRadius", defaults.DensityRadius, "Cut the density kernel off at this radius, below the neighbor search radius of 4; 0 for the same")
+	flag.Float64Var(&minDistance, "minDistance", defaults.MinParticleDistance, "Push apart particles closer than this after each step, moving positions only; 0 to disable")
+	flag.Float64Var(&restThreshold, "restThreshold", defaults.RestPressureThreshold, "Soften pressure for particles less than this fraction above rest density, reducing clumping on the floor; 0 to disable")
+	flag.IntVar(&maxNeighbors, "maxNeighbors", defaults.MaxNeighbors, "Keep only this many nearest neighbors per particle, bounding the cost of dense clumps; 0 for all")
+	flag.Float64Var(&neighborSkin, "neighborSkin", defaults.NeighborSkin, "Widen the neighbor search by this fraction of the interaction radius and reuse it until a particle has moved half that far; 0 to search every step")
+	flag.BoolVar(&correctPressure, "correctPressure", defaults.CorrectPressureForce, "Use the standard SPH pressure force, weighted by neighbor mass and density, instead of the simplified one")
+	flag.BoolVar(&correctViscosity, "correctViscosity", defaults.CorrectViscosityForce, "Use the standard SPH viscosity force, which scales with -nu, instead of the simplified one")
+	flag.BoolVar(&noRepulsion, "noRepulsion", defaults.NoDensityRepulsion, "Drop the push away from lower density neighbors, which keeps a pool from ever coming to rest")
+	flag.BoolVar(&granular, "granular", defaults.Material == simulation.Granular, "Simulate sand instead of fluid: grains that collide with friction and heap up rather than flow")
+	flag.BoolVar(&recenter, "recenter", defaults.AutoRecenter, "Pull the fluid back into the domain when more than a tenth of it has escaped")
+	flag.Float64Var(&pistonSpeed, "piston", 0, "Start with a piston pressing down from the top at this speed; 0 for none")
+	flag.BoolVar(&damBreak, "dambreak", false, "Start with a dam break: a lattice block of fluid filling the left half")
+	flag.Float64Var(&taylorGreen, "taylorgreen", 0, "Start with a Taylor-Green vortex of this peak speed on a lattice, with periodic boundaries; 0 for none")
+	flag.Float64Var(&shear, "shear", 0, "Start the particles in a horizontal shear layer, the top half flowing right at this speed and the bottom half left; 0 for none")
+	flag.Float64Var(&vortex, "vortex", 0, "Start the particles turning in a single vortex at the center with this peak speed; 0 for none")
+	flag.Float64Var(&tunnelSpeed, "tunnel", 0, "Run a wind tunnel: inflow on the left at this speed, outflow on the right, periodic top and bottom; 0 for none")
+	flag.BoolVar(&obstacle, "obstacle", false, "Start the wind tunnel with an obstacle in the middle")
+	flag.Float64Var(&jitter, "jitter", defaults.InitialJitter, "Random offset of lattice starting positions, in lattice spacings; reproducible with -seed")
+	flag.StringVar(&maskPath, "mask", "", "PNG whose opaque dark pixels define where particles start")
+	flag.BoolVar(&headless, "headless", false, "Run without a window")
+	flag.IntVar(&steps, "steps", 1000, "Number of steps to run in headless mode")
+	flag.Float64Var(&settledSpeed, "runUntilSettled", 0, "In headless mode, stop once the fluid has moved and come to rest, with mean speed below this; -steps caps the run; 0 to run all steps")
+	flag.StringVar(&offscreenDir, "offscreen", "", "Run without a window, rendering frames with the software renderer and saving them as PNGs in this directory")
+	flag.IntVar(&frameEvery, "frameEvery", 10, "Save an -offscreen frame every this many steps")
+	flag.StringVar(&sweepSpec, "sweep", "", "Sweep a parameter as param=min:max:steps (e.g. nu=0.5:2:4), running -steps headless steps per value, and print the results as CSV")
+	flag.StringVar(&sideBySideSpec, "sideBySide", "", "Run one sim per value of a parameter, given as param=min:max:steps like -sweep, side by side in one window")
+	flag.StringVar(&statsPath, "stats", "", "Write per-step statistics as JSON lines to this file (headless mode)")
+	flag.StringVar(&serveAddr, "serve", "", "Serve the simulation to a browser at this address (e.g. :8080) instead of opening a window")
+	flag.Int64Var(&seed, "seed", 0, "Random seed; 0 picks one from the clock")
+	flag.StringVar(&recordPath, "record", "", "Write the final particle state to this CSV file (headless mode)")
+	flag.StringVar(&graphPath, "graph", "", "Write the final neighbor graph to this file as an edge list (headless mode)")
+	flag.StringVar(&pressurePngPath, "pressurePng", "", "Write the final pressure field to this file as a grayscale PNG (headless mode)")
+	flag.StringVar(&comparePath, "compare", "", "Run headless and compare the final state against this golden CSV, exiting nonzero on a mismatch")
+	flag.StringVar(&background, "background", "#000000", "Background color as #rrggbb")
+	flag.Float64Var(&splashSpeed, "splash", 0, "Flash a ring where a particle hits a wall faster than this speed; 0 for none")
+	flag.BoolVar(&additive, "additive", false, "Blend particles additively so overlaps glow")
+	flag.BoolVar(&densityAlpha, "densityAlpha", false, "Fade particles sparser than the mean density, so the edges of the fluid blend into the background")
+	flag.BoolVar(&mesh, "mesh", false, "Draw lines from each particle to its closest neighbors under the particles")
+	flag.IntVar(&neighborDrawLimit, "neighborDrawLimit", 3, "Closest neighbors per particle the mesh connects to; 0 for all of them")
+	flag.Float64Var(&tolerance, "tolerance", 1e-9, "Largest position or velocity difference -compare accepts")
 
 	flag.Parse()
 
-	rand.Seed(time.Now().Unix())
+	params := defaults
+	params.Dt, params.Rho0, params.Nu = dt, rho0, nu
+	params.PressureMultiplier, params.Gravity, params.MouseForce = pressureMultiplier, gravity, mouseForce
+	params.SettleSteps, params.RelaxIterations, params.InitialJitter = settleSteps, relaxIterations, jitter
+	params.RadiusVariation, params.Restitution, params.MaxSpeed = radiusVariation, restitution, maxSpeed
+	params.Adhesion, params.RestPressureThreshold, params.MaxNeighbors = adhesion, restThreshold, maxNeighbors
+	params.Friction, params.AutoRecenter, params.MinParticleDistance = friction, recenter, minDistance
+	params.DensityRadius, params.CorrectPressureForce = densityRadius, correctPressure
+	params.CorrectViscosityForce, params.NoDensityRepulsion = correctViscosity, noRepulsion
+	params.DivergenceFree = divergenceFree
+	params.NeighborSkin = neighborSkin
+	params.Material = simulation.Fluid
+	if granular {
+		params.Material = simulation.Granular
+	}
+	if err := params.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if substeps < 1 {
+		substeps = 1
+	}
+
+	gridType := spatial.MapGrid
+	if hashGrid {
+		gridType = spatial.HashGridType
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rand.Seed(seed)
+
+	domain := simulation.Domain{X: domainX, Y: domainY}
+	if circle {
+		domain = simulation.CircleDomain(math.Min(domainX, domainY) / 2)
+	}
+
+	var initialCondition simulation.InitialConditionFunc
+	if damBreak {
+		initialCondition = simulation.DamBreakInitialCondition(domain, n, jitter)
+	}
+	// the vortex wraps around the domain edges, so it needs periodic walls
+	periodic := taylorGreen != 0
+	if periodic {
+		initialCondition = simulation.TaylorGreenInitialCondition(domain, n, taylorGreen)
+	}
+	if maskPath != "" {
+		ic, err := simulation.ImageMaskInitialCondition(maskPath, domain, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		initialCondition = ic
+	}
+
+	// a velocity field sets the starting velocities wherever the particles
+	// were placed
+	var velocityField simulation.VelocityField
+	if shear != 0 {
+		velocityField = simulation.ShearLayerField(domain, shear)
+	}
+	if vortex != 0 {
+		velocityField = simulation.SingleVortexField(domain, vortex)
+	}
+
+	if sweepSpec != "" {
+		cfg, err := simulation.ParseSweepSpec(sweepSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Base = params
+		cfg.Base.DivergenceFree = divergenceFree
+		cfg.N, cfg.Domain, cfg.Seed, cfg.SettledSpeed = n, domain, seed, settledSpeed
+		cfg.InitialCondition, cfg.VelocityField, cfg.Periodic = initialCondition, velocityField, periodic
+		if err := simulation.WriteSweepCSV(os.Stdout, simulation.RunSweep(cfg, steps)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if comparePath != "" || recordPath != "" || graphPath != "" || pressurePngPath != "" || offscreenDir != "" {
+		headless = true
+	}
+
+	style := viz.DefaultRenderStyle()
+	style.Additive = additive
+	style.DensityAlpha = densityAlpha
+	style.NeighborMesh = mesh
+	style.NeighborDrawLimit = neighborDrawLimit
+	bg, err := viz.ParseColor(background)
+	if err != nil {
+		log.Fatal(err)
+	}
+	style.Background = bg
+	style.Letterbox = !stretch
+
+	if sideBySideSpec != "" {
+		cfg, err := simulation.ParseSweepSpec(sideBySideSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Base = params
+		cfg.Base.DivergenceFree = divergenceFree
+		cfg.N, cfg.Domain, cfg.Seed = n, domain, seed
+		cfg.InitialCondition, cfg.VelocityField, cfg.Periodic = initialCondition, velocityField, periodic
+		RunSideBySide(cfg, frameRate, particleRadius, style)
+		return
+	}
+
+	opts := simOptions{
+		n:                n,
+		domain:           domain,
+		gridType:         gridType,
+		initialCondition: initialCondition,
+		velocityField:    velocityField,
+		periodic:         periodic,
+		pistonSpeed:      pistonSpeed,
+		tunnelSpeed:      tunnelSpeed,
+		obstacle:         obstacle,
+		doubleBuffer:     doubleBuffer,
+		sortNeighbors:    sortNeighbors,
+		splashSpeed:      splashSpeed,
+	}
+
+	if headless || serveAddr != "" {
+		fluidSim := buildSim(opts, params)
+
+		var stats *simulation.StatsWriter
+		if statsPath != "" {
+			f, err := os.Create(statsPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			stats = simulation.NewStatsWriter(f)
+		}
+
+		if autoDt > 0 {
+			dt = fluidSim.AutoTuneDtWith(simulation.StepParams{Gravity: gravity, PressureMultiplier: pressureMultiplier}, autoDt)
+			fluidSim.Dt = dt
+			fmt.Printf("auto-tuned -dt %g\n", dt)
+		}
+		fluidSim.Settle(settleSteps, pressureMultiplier, dt)
+		if serveAddr != "" {
+			RunServer(fluidSim, serveAddr, frameRate, substeps, gravity, pressureMultiplier, dt)
+			return
+		}
+		if offscreenDir != "" {
+			if err := RunOffscreen(fluidSim, steps, frameEvery, offscreenDir, gravity, pressureMultiplier, dt, particleRadius, stats, settledSpeed, style); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			RunHeadless(fluidSim, steps, gravity, pressureMultiplier, dt, stats, settledSpeed, nil)
+		}
+
+		if recordPath != "" {
+			if err := recordState(recordPath, fluidSim); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if graphPath != "" {
+			if err := writeGraph(graphPath, fluidSim); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if pressurePngPath != "" {
+			if err := writePressurePng(pressurePngPath, fluidSim); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if comparePath != "" && !compareState(comparePath, fluidSim, tolerance) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	RunSimulation(
-		time.Now().Unix(),
-		n,
-		dt,
-		rho0,
-		nu,
-		domainX,
-		domainY,
-		pressureMultiplier,
+		seed,
+		opts,
+		params,
 		frameRate,
 		particleRadius,
-		gravity,
-		mouseForce,
+		wellStrength,
+		substeps,
+		autoDt,
+		idleSpeed,
+		time.Duration(frameBudgetMs*float64(time.Millisecond)),
+		saveConfigPath,
+		style,
 	)
 }
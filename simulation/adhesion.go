@@ -0,0 +1,45 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+)
+
+// CalculateAdhesionForce pulls a particle toward any reflective wall within
+// one interaction radius, or pushes it away for negative Adhesion. Like
+// gravity it scales with density, and it falls off as (1 - d/h)^2 with the
+// distance d to the wall, so fluid touching a wall feels it most. Positive
+// adhesion makes fluid wet and creep up walls; negative makes it bead away.
+func (sim *FluidSim) CalculateAdhesionForce(p *core.Particle) core.Vector {
+	var force core.Vector
+	h := sim.InteractionRadius
+	strength := sim.Adhesion * p.Density
+
+	// pull toward a wall at distance d along the unit direction (nx, ny)
+	pull := func(d, nx, ny float64) {
+		if d >= h {
+			return
+		}
+		falloff := 1 - math.Max(d, 0)/h
+		force.X += strength * falloff * falloff * nx
+		force.Y += strength * falloff * falloff * ny
+	}
+
+	if sim.LeftBoundary == spatial.Reflective {
+		pull(p.X, -1, 0)
+		pull(sim.Domain.X-p.X, 1, 0)
+	}
+	if sim.TopBoundary == spatial.Reflective {
+		pull(p.Y, 0, -1)
+		pull(sim.Domain.Y-p.Y, 0, 1)
+	}
+	if sim.Domain.Shape == Circle {
+		cx, cy := sim.Domain.Center()
+		dx, dy := p.X-cx, p.Y-cy
+		if r := math.Hypot(dx, dy); r > 0 {
+			pull(sim.Domain.Radius-r, dx/r, dy/r)
+		}
+	}
+	return force
+}
@@ -0,0 +1,36 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestAdhesionForce(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	nearLeft := &core.Particle{X: 1, Y: 50, Density: 1}
+	middle := &core.Particle{X: 50, Y: 50, Density: 1}
+
+	if f := sim.CalculateAdhesionForce(nearLeft); f.X != 0 || f.Y != 0 {
+		t.Errorf("zero adhesion gave force %+v", f)
+	}
+
+	sim.Adhesion = 100
+	if f := sim.CalculateAdhesionForce(nearLeft); f.X >= 0 || f.Y != 0 {
+		t.Errorf("positive adhesion pushed a particle by the left wall with %+v, want toward the wall", f)
+	}
+	if f := sim.CalculateAdhesionForce(middle); f.X != 0 || f.Y != 0 {
+		t.Errorf("particle far from walls felt %+v", f)
+	}
+
+	sim.Adhesion = -100
+	if f := sim.CalculateAdhesionForce(nearLeft); f.X <= 0 {
+		t.Errorf("negative adhesion gave %+v, want away from the wall", f)
+	}
+
+	// closer to the wall pulls harder
+	sim.Adhesion = 100
+	closer := sim.CalculateAdhesionForce(&core.Particle{X: 0.5, Y: 50, Density: 1})
+	if further := sim.CalculateAdhesionForce(nearLeft); closer.X >= further.X {
+		t.Errorf("force at 0.5 (%v) not stronger than at 1 (%v)", closer.X, further.X)
+	}
+}
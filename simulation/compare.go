@@ -0,0 +1,100 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"fluids/core"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Comparison is the largest per-particle difference between two states and
+// the particles it occurred at.
+type Comparison struct {
+	MaxPosDiff float64
+	MaxVelDiff float64
+	PosIndex   int // particle with the largest position difference, -1 if none
+	VelIndex   int // particle with the largest velocity difference, -1 if none
+}
+
+// Compare returns the largest position and velocity differences between
+// corresponding particles of two simulations.
+func Compare(a, b *FluidSim) (maxPosDiff, maxVelDiff float64) {
+	c := CompareParticles(a.Particles, b.Particles)
+	return c.MaxPosDiff, c.MaxVelDiff
+}
+
+// CompareParticles compares particle states index by index. States of
+// different lengths can't be matched up, so every difference is reported as
+// infinite.
+func CompareParticles(a, b []core.Particle) Comparison {
+	c := Comparison{PosIndex: -1, VelIndex: -1}
+	if len(a) != len(b) {
+		c.MaxPosDiff, c.MaxVelDiff = math.Inf(1), math.Inf(1)
+		return c
+	}
+	for i := range a {
+		pos := math.Hypot(a[i].X-b[i].X, a[i].Y-b[i].Y)
+		if pos > c.MaxPosDiff || c.PosIndex < 0 {
+			c.MaxPosDiff, c.PosIndex = pos, i
+		}
+		vel := math.Hypot(a[i].Vx-b[i].Vx, a[i].Vy-b[i].Vy)
+		if vel > c.MaxVelDiff || c.VelIndex < 0 {
+			c.MaxVelDiff, c.VelIndex = vel, i
+		}
+	}
+	return c
+}
+
+var stateHeader = []string{"x", "y", "vx", "vy"}
+
+// WriteStateCSV writes particle positions and velocities as CSV, one row per
+// particle in index order. Values are written at full precision so a state
+// read back compares exactly equal.
+func WriteStateCSV(w io.Writer, particles []core.Particle) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(stateHeader); err != nil {
+		return err
+	}
+	for i := range particles {
+		p := &particles[i]
+		record := []string{
+			strconv.FormatFloat(p.X, 'g', -1, 64),
+			strconv.FormatFloat(p.Y, 'g', -1, 64),
+			strconv.FormatFloat(p.Vx, 'g', -1, 64),
+			strconv.FormatFloat(p.Vy, 'g', -1, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadStateCSV reads a state written by WriteStateCSV. Only positions and
+// velocities are filled in.
+func ReadStateCSV(r io.Reader) ([]core.Particle, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(stateHeader)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("state csv is empty")
+	}
+	particles := make([]core.Particle, len(records)-1)
+	for i, record := range records[1:] {
+		var values [4]float64
+		for j, field := range record {
+			values[j], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+		particles[i] = core.Particle{X: values[0], Y: values[1], Vx: values[2], Vy: values[3]}
+	}
+	return particles, nil
+}
@@ -0,0 +1,58 @@
+package simulation
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func newSeededSim(seed int64) *FluidSim {
+	rand.Seed(seed)
+	sim := NewFluidSim(200, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	for step := 0; step < 20; step++ {
+		sim.Advance(-1000, 10000, sim.Dt)
+	}
+	return sim
+}
+
+func TestCompareDeterministicRuns(t *testing.T) {
+	a, b := newSeededSim(7), newSeededSim(7)
+	if pos, vel := Compare(a, b); pos != 0 || vel != 0 {
+		t.Errorf("same seed diverged: pos %v, vel %v", pos, vel)
+	}
+}
+
+func TestCompareReportsWorstParticle(t *testing.T) {
+	a := newSeededSim(7)
+	b := newSeededSim(7)
+	b.Particles[42].X += 0.5
+	b.Particles[17].Vy -= 2
+
+	c := CompareParticles(a.Particles, b.Particles)
+	if c.PosIndex != 42 || math.Abs(c.MaxPosDiff-0.5) > 1e-12 {
+		t.Errorf("position diff %v at %d, want 0.5 at 42", c.MaxPosDiff, c.PosIndex)
+	}
+	if c.VelIndex != 17 || math.Abs(c.MaxVelDiff-2) > 1e-12 {
+		t.Errorf("velocity diff %v at %d, want 2 at 17", c.MaxVelDiff, c.VelIndex)
+	}
+
+	if c := CompareParticles(a.Particles, b.Particles[1:]); !math.IsInf(c.MaxPosDiff, 1) {
+		t.Errorf("mismatched lengths compared as %v", c.MaxPosDiff)
+	}
+}
+
+func TestStateCSVRoundTrip(t *testing.T) {
+	sim := newSeededSim(3)
+	var buf bytes.Buffer
+	if err := WriteStateCSV(&buf, sim.Particles); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ReadStateCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := CompareParticles(sim.Particles, golden); c.MaxPosDiff != 0 || c.MaxVelDiff != 0 {
+		t.Errorf("round trip changed state: %+v", c)
+	}
+}
@@ -0,0 +1,72 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadParams reads parameters saved by SaveParams, or written by hand, from
+// a JSON file. Fields the file leaves out keep their values from base, so a
+// config only needs the settings it changes. Unknown fields are an error, to
+// catch misspelled names.
+func LoadParams(path string, base SimParameters) (SimParameters, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return base, err
+	}
+	defer f.Close()
+
+	params := base
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&params); err != nil {
+		return base, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := params.Validate(); err != nil {
+		return base, fmt.Errorf("%s: %w", path, err)
+	}
+	return params, nil
+}
+
+// SaveParams writes the parameters to a JSON file that LoadParams reads.
+func SaveParams(path string, params SimParameters) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Tunables is the inverse of ApplyTunables: base with every setting the sim
+// itself holds replaced by its current value, so settings changed mid-run
+// are captured. The settings the caller passes to each step, the time step,
+// gravity, and the pressure multiplier, are left as base has them.
+func (sim *FluidSim) Tunables(base SimParameters) SimParameters {
+	params := base
+	params.Rho0 = sim.Rho0
+	params.Nu = sim.Nu
+	params.InteractionRadius = sim.InteractionRadius
+	params.DensityRadius = sim.DensityRadius
+	params.RadiusBase = sim.RadiusBase
+	params.RadiusVariation = sim.RadiusVariation
+	params.Restitution = sim.Restitution
+	params.MaxSpeed = sim.MaxSpeed
+	params.Adhesion = sim.Adhesion
+	params.Friction = sim.Friction
+	params.EscapeThreshold = sim.EscapeThreshold
+	params.AutoRecenter = sim.AutoRecenter
+	params.MinParticleDistance = sim.MinParticleDistance
+	params.RestPressureThreshold = sim.RestPressureThreshold
+	params.CorrectPressureForce = sim.CorrectPressureForce
+	params.CorrectViscosityForce = sim.CorrectViscosityForce
+	params.NoDensityRepulsion = sim.NoDensityRepulsion
+	params.DivergenceFree = sim.DivergenceFree
+	params.DivergenceIterations = sim.DivergenceIterations
+	params.NeighborCapacityHint = sim.NeighborCapacityHint
+	params.MaxNeighbors = sim.MaxNeighbors
+	params.NeighborSkin = sim.NeighborSkin
+	params.Material = sim.Material
+	params.GranularFriction = sim.GranularFriction
+	return params
+}
@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveParamsRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "params.json")
+	params := GetDefaultSimParameters()
+	params.Gravity, params.Nu, params.InteractionRadius = -5000, 0.25, 6
+	params.Material, params.AutoRecenter = Granular, true
+	if err := SaveParams(path, params); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadParams(path, SimParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != params {
+		t.Errorf("loaded %+v, saved %+v", loaded, params)
+	}
+}
+
+func TestLoadParamsKeepsUnsetFields(t *testing.T) {
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "partial.json")
+	if err := os.WriteFile(partial, []byte(`{"Nu": 3, "Gravity": -100}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	base := GetDefaultSimParameters()
+	loaded, err := LoadParams(partial, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := base
+	want.Nu, want.Gravity = 3, -100
+	if loaded != want {
+		t.Errorf("loaded %+v, want the defaults with Nu and Gravity changed", loaded)
+	}
+
+	typo := filepath.Join(dir, "typo.json")
+	if err := os.WriteFile(typo, []byte(`{"Viscosity": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadParams(typo, base); err == nil || !strings.Contains(err.Error(), "Viscosity") {
+		t.Errorf("unknown field gave error %v, want one naming it", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"Dt": -1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadParams(invalid, base); err == nil {
+		t.Errorf("negative Dt loaded without error")
+	}
+}
+
+func TestTunablesUndoesApplyTunables(t *testing.T) {
+	sim := NewFluidSim(10, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	params := GetDefaultSimParameters()
+	params.Rho0, params.Nu, params.Adhesion, params.Friction = 2, 0.5, 30, 0.2
+	params.InteractionRadius, params.MaxNeighbors, params.CorrectPressureForce = 5, 12, true
+	params.NeighborSkin = 0.3
+	sim.ApplyTunables(params)
+	if got := sim.Tunables(params); got != params {
+		t.Errorf("Tunables gave %+v after applying %+v", got, params)
+	}
+
+	// a setting changed mid-run shows up
+	sim.SetInteractionRadius(7)
+	if got := sim.Tunables(params).InteractionRadius; got != 7 {
+		t.Errorf("InteractionRadius %v after changing it to 7", got)
+	}
+}
+
+func TestSavedParamsApplyToANewSim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "params.json")
+	running := NewFluidSim(50, Domain{X: 40, Y: 40}, 0.0005, 1, 1)
+	params := GetDefaultSimParameters()
+	params.Rho0, params.Nu, params.InteractionRadius, params.DensityRadius = 2, 0.5, 5, 4
+	params.RadiusBase, params.RadiusVariation = 1.5, 0.4
+	params.Restitution, params.MaxSpeed, params.Adhesion, params.Friction = 0.5, 80, 30, 0.2
+	params.EscapeThreshold, params.AutoRecenter, params.MinParticleDistance = 0.3, true, 0.5
+	params.RestPressureThreshold, params.CorrectPressureForce = 0.05, true
+	params.CorrectViscosityForce, params.NoDensityRepulsion = true, true
+	params.DivergenceFree, params.DivergenceIterations = true, 7
+	params.NeighborCapacityHint, params.MaxNeighbors, params.NeighborSkin = 48, 12, 0.3
+	params.Material, params.GranularFriction = Granular, 0.8
+	running.ApplyTunables(params)
+	if err := SaveParams(path, running.Tunables(GetDefaultSimParameters())); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadParams(path, SimParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewFluidSim(50, Domain{X: 40, Y: 40}, 0.0005, 1, 1)
+	sim.ApplyTunables(loaded)
+	if got := sim.Tunables(loaded); got != loaded {
+		t.Errorf("new sim holds %+v after applying the saved %+v", got, loaded)
+	}
+	if sim.RadiusBase != 1.5 || sim.RadiusVariation != 0.4 || sim.DivergenceIterations != 7 || !sim.DivergenceFree {
+		t.Errorf("RadiusBase %v, RadiusVariation %v, DivergenceIterations %v, DivergenceFree %v; want 1.5, 0.4, 7, true",
+			sim.RadiusBase, sim.RadiusVariation, sim.DivergenceIterations, sim.DivergenceFree)
+	}
+	for i, p := range sim.Particles {
+		if p.Radius < 1.5*0.8 || p.Radius > 1.5*1.2 {
+			t.Fatalf("particle %d has radius %v, want it drawn from 1.5 ± 20%%", i, p.Radius)
+		}
+	}
+}
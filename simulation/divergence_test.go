@@ -0,0 +1,100 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func meanDensityRate(sim *FluidSim, dt float64) float64 {
+	neighbors := sim.neighborIndexLists()
+	vel := make([]core.Vector, len(sim.Particles))
+	for i, p := range sim.Particles {
+		vel[i] = core.Vector{X: p.Vx + p.Force.X*dt, Y: p.Vy + p.Force.Y*dt}
+	}
+	sum := 0.0
+	for i := range sim.Particles {
+		sum += math.Abs(sim.densityRate(i, neighbors[i], vel))
+	}
+	return sum / float64(len(sim.Particles))
+}
+
+func TestProjectDivergenceFreeReducesDivergence(t *testing.T) {
+	const dt = 0.001
+	sim := newLatticeSim(30, 1.0, 4)
+	rng := rand.New(rand.NewSource(3))
+	for i := range sim.Particles {
+		sim.Particles[i].Vx = rng.Float64()*2 - 1
+		sim.Particles[i].Vy = rng.Float64()*2 - 1
+	}
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+	sim.UpdateDensities()
+
+	var momentumBefore core.Vector
+	for _, p := range sim.Particles {
+		momentumBefore.Add(&core.Vector{X: p.Vx, Y: p.Vy})
+	}
+
+	before := meanDensityRate(sim, dt)
+	sim.DivergenceIterations = 10
+	sim.ProjectDivergenceFree(dt)
+	after := meanDensityRate(sim, dt)
+
+	if after > 0.5*before {
+		t.Errorf("mean |D rho/Dt| went from %v to %v, want at least halved", before, after)
+	}
+
+	// the correction is pairwise symmetric, so it adds no net momentum
+	var momentumAfter core.Vector
+	for _, p := range sim.Particles {
+		momentumAfter.Add(&core.Vector{X: p.Vx + p.Force.X*dt, Y: p.Vy + p.Force.Y*dt})
+	}
+	// up to the roundoff of folding the correction into a force and back
+	if math.Abs(momentumAfter.X-momentumBefore.X) > 1e-6 || math.Abs(momentumAfter.Y-momentumBefore.Y) > 1e-6 {
+		t.Errorf("momentum changed from %v to %v", momentumBefore, momentumAfter)
+	}
+}
+
+// wrappedBlob is an 8x8 block of particles with random velocities whose
+// center sits at (cx, cy) in a periodic 40x40 box, wrapped around its edges.
+func wrappedBlob(cx, cy float64) *FluidSim {
+	sim := NewFluidSim(64, Domain{X: 40, Y: 40}, 0.0005, 1, 1)
+	sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	rng := rand.New(rand.NewSource(7))
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		p.X = math.Mod(cx-3.5+float64(i%8)+40, 40)
+		p.Y = math.Mod(cy-3.5+float64(i/8)+40, 40)
+		p.Vx, p.Vy = rng.Float64()*2-1, rng.Float64()*2-1
+	}
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+	sim.UpdateDensities()
+	sim.UpdatePressure(100)
+	return sim
+}
+
+func TestPressureAndProjectionSeeAcrossPeriodicEdges(t *testing.T) {
+	// the same blob in the middle of the box and split over its corner
+	inside, split := wrappedBlob(20, 20), wrappedBlob(0, 0)
+	insideLists, splitLists := inside.neighborIndexLists(), split.neighborIndexLists()
+	for i := range inside.Particles {
+		a := inside.CalculateCorrectPressureForce(i, insideLists[i])
+		b := split.CalculateCorrectPressureForce(i, splitLists[i])
+		if math.Abs(a.X-b.X) > 1e-9 || math.Abs(a.Y-b.Y) > 1e-9 {
+			t.Fatalf("particle %d: pressure force %v split over the corner, %v inside", i, *b, *a)
+		}
+	}
+
+	inside.ProjectDivergenceFree(0.001)
+	split.ProjectDivergenceFree(0.001)
+	for i := range inside.Particles {
+		a, b := inside.Particles[i].Force, split.Particles[i].Force
+		if math.Abs(a.X-b.X) > 1e-9 || math.Abs(a.Y-b.Y) > 1e-9 {
+			t.Fatalf("particle %d: projection force %v split over the corner, %v inside", i, b, a)
+		}
+	}
+}
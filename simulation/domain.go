@@ -0,0 +1,90 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+	"math/rand"
+)
+
+type DomainShape int
+
+const (
+	Rect   DomainShape = iota // the full X by Y box
+	Circle                    // a disc of Radius centered in the box
+)
+
+// CircleDomain returns a circular tank of the given radius. The bounding box,
+// which the grid and renderer still work in, is exactly the disc's diameter.
+func CircleDomain(radius float64) Domain {
+	return Domain{X: 2 * radius, Y: 2 * radius, Shape: Circle, Radius: radius}
+}
+
+// Center is the middle of the bounding box, and the center of a circular domain.
+func (d Domain) Center() (float64, float64) {
+	return d.X / 2, d.Y / 2
+}
+
+// Area is the area particles can occupy.
+func (d Domain) Area() float64 {
+	if d.Shape == Circle {
+		return math.Pi * d.Radius * d.Radius
+	}
+	return d.X * d.Y
+}
+
+// Contains reports whether (x, y) lies inside the domain. A NaN coordinate
+// is outside.
+func (d Domain) Contains(x, y float64) bool {
+	if !(x >= 0 && x <= d.X && y >= 0 && y <= d.Y) {
+		return false
+	}
+	if d.Shape == Circle {
+		cx, cy := d.Center()
+		return (x-cx)*(x-cx)+(y-cy)*(y-cy) <= d.Radius*d.Radius
+	}
+	return true
+}
+
+// randomPoint samples a uniform position inside the domain by rejection.
+func (d Domain) randomPoint() (float64, float64) {
+	for {
+		x := rand.Float64() * d.X
+		y := rand.Float64() * d.Y
+		if d.Contains(x, y) {
+			return x, y
+		}
+	}
+}
+
+// confineCircle moves a point that has left the circular wall back just
+// inside it, returning the outward normal at the wall and whether it moved.
+func (d Domain) confineCircle(x, y *float64) (nx, ny float64, moved bool) {
+	cx, cy := d.Center()
+	dx, dy := *x-cx, *y-cy
+	r := math.Hypot(dx, dy)
+	if r < d.Radius || r == 0 {
+		return 0, 0, false
+	}
+	nx, ny = dx/r, dy/r
+	*x = cx + nx*(d.Radius-spatial.EPSILON)
+	*y = cy + ny*(d.Radius-spatial.EPSILON)
+	return nx, ny, true
+}
+
+// reflectCircle bounces a particle that has crossed the circular wall back
+// inside, reversing its velocity along the radial normal with the given
+// restitution. The tangential velocity is untouched. It returns the normal
+// speed of the impact, 0 if there was none.
+func (d Domain) reflectCircle(x, y, vx, vy *float64, restitution float64) float64 {
+	nx, ny, moved := d.confineCircle(x, y)
+	if !moved {
+		return 0
+	}
+	vn := *vx*nx + *vy*ny
+	if vn <= 0 {
+		return 0
+	}
+	*vx -= (1 + restitution) * vn * nx
+	*vy -= (1 + restitution) * vn * ny
+	return vn
+}
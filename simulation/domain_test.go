@@ -0,0 +1,48 @@
+package simulation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCircleDomainKeepsParticlesInside(t *testing.T) {
+	domain := CircleDomain(25)
+	sim := NewFluidSim(200, domain, 0.0005, 1, 1)
+	for _, p := range sim.Particles {
+		if !domain.Contains(p.X, p.Y) {
+			t.Fatalf("particle spawned outside the circle at (%v, %v)", p.X, p.Y)
+		}
+	}
+
+	for step := 0; step < 100; step++ {
+		sim.Advance(-10000, 10000, sim.Dt)
+	}
+	for i, p := range sim.Particles {
+		if !domain.Contains(p.X, p.Y) {
+			t.Fatalf("particle %d escaped to (%v, %v)", i, p.X, p.Y)
+		}
+	}
+}
+
+func TestCircleReflectionUsesRadialNormal(t *testing.T) {
+	domain := CircleDomain(10)
+	// just past the wall at 45 degrees, moving straight right
+	d := 10.01 / math.Sqrt2
+	x, y, vx, vy := 10+d, 10+d, 1.0, 0.0
+	domain.reflectCircle(&x, &y, &vx, &vy, 1)
+
+	if r := math.Hypot(x-10, y-10); r >= 10 {
+		t.Errorf("reflected particle left at radius %v", r)
+	}
+	// mirroring (1, 0) in the 45 degree wall gives (0, -1)
+	if math.Abs(vx) > 1e-12 || math.Abs(vy+1) > 1e-12 {
+		t.Errorf("reflected velocity (%v, %v), want (0, -1)", vx, vy)
+	}
+
+	// a particle already heading back inside keeps its velocity
+	x, y, vx, vy = 10+d, 10+d, -1, 0
+	domain.reflectCircle(&x, &y, &vx, &vy, 1)
+	if vx != -1 || vy != 0 {
+		t.Errorf("inbound velocity changed to (%v, %v)", vx, vy)
+	}
+}
@@ -0,0 +1,35 @@
+package simulation
+
+// PaintDye sets the dye color of every particle within radius of (x, y).
+func (sim *FluidSim) PaintDye(x, y, radius float64, r, g, b uint8) {
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		p := &sim.Particles[i]
+		dx, dy := p.X-x, p.Y-y
+		if dx*dx+dy*dy <= radius*radius {
+			p.R, p.G, p.B = r, g, b
+		}
+	})
+}
+
+// DiffuseDye blends each particle's dye toward the mean color of its
+// neighbors by rate (0 leaves colors unchanged, 1 replaces them). Neighbor
+// colors are the copies taken by the last FindNeighbors, so every particle
+// blends against the same snapshot regardless of update order.
+func (sim *FluidSim) DiffuseDye(rate float64) {
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		p := &sim.Particles[i]
+		if len(p.Neighbors) == 0 {
+			return
+		}
+		var r, g, b float64
+		for _, neighbor := range p.Neighbors {
+			r += float64(neighbor.R)
+			g += float64(neighbor.G)
+			b += float64(neighbor.B)
+		}
+		n := float64(len(p.Neighbors))
+		p.R = uint8(float64(p.R)*(1-rate) + r/n*rate + 0.5)
+		p.G = uint8(float64(p.G)*(1-rate) + g/n*rate + 0.5)
+		p.B = uint8(float64(p.B)*(1-rate) + b/n*rate + 0.5)
+	})
+}
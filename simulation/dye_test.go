@@ -0,0 +1,32 @@
+package simulation
+
+import "testing"
+
+func TestDyePaintAndDiffuse(t *testing.T) {
+	sim := newLatticeSim(21, 1.0, 4)
+	for i := range sim.Particles {
+		sim.Particles[i].R, sim.Particles[i].G, sim.Particles[i].B = 255, 255, 255
+	}
+	sim.PaintDye(10.5, 10.5, 2, 255, 0, 0)
+
+	center := (21/2)*21 + 21/2
+	if p := sim.Particles[center]; p.R != 255 || p.G != 0 || p.B != 0 {
+		t.Fatalf("center not painted: (%d, %d, %d)", p.R, p.G, p.B)
+	}
+
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+	sim.DiffuseDye(0.5)
+
+	// the dyed spot bleeds outward and fades at its center
+	if p := sim.Particles[center]; p.G == 0 {
+		t.Errorf("center dye did not diffuse: (%d, %d, %d)", p.R, p.G, p.B)
+	}
+	edge := (21/2)*21 + 21/2 + 3
+	if p := sim.Particles[edge]; p.G == 255 {
+		t.Errorf("dye did not spread to a particle 3 spacings away")
+	}
+	if p := sim.Particles[0]; p.R != 255 || p.G != 255 || p.B != 255 {
+		t.Errorf("far corner changed color: (%d, %d, %d)", p.R, p.G, p.B)
+	}
+}
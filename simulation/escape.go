@@ -0,0 +1,94 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+)
+
+// DefaultEscapeThreshold is the fraction of particles outside the domain at
+// which the fluid is taken to be getting away, rather than a few particles
+// caught mid-bounce.
+const DefaultEscapeThreshold = 0.1
+
+// escapedFraction is the fraction of particles outside the domain, counting
+// those whose position has gone NaN or infinite.
+func (sim *FluidSim) escapedFraction() float64 {
+	if len(sim.Particles) == 0 {
+		return 0
+	}
+	escaped := sim.parallelReduce(0, len(sim.Particles), 0, func(i int) float64 {
+		if p := &sim.Particles[i]; !sim.Domain.Contains(p.X, p.Y) {
+			return 1
+		}
+		return 0
+	}, sum)
+	return escaped / float64(len(sim.Particles))
+}
+
+// checkEscape records the escaped fraction after a step and, with
+// AutoRecenter, pulls the fluid back once it passes EscapeThreshold.
+func (sim *FluidSim) checkEscape() {
+	sim.EscapedFraction = sim.escapedFraction()
+	if sim.AutoRecenter && sim.EscapedFraction > sim.EscapeThreshold {
+		sim.Recenter()
+	}
+}
+
+// Recenter brings escaped particles back into the domain and returns how
+// many it moved. If the fluid as a whole has drifted out, every particle is
+// shifted so its centroid sits at the domain center, keeping the fluid's
+// shape; a fluid whose centroid is inside is not shifted. Particles still
+// outside are then pulled onto the nearest wall, and those whose position is
+// no longer a number are dropped at a random point. Moved particles are
+// stopped, since whatever sent them out has given them bad velocities.
+func (sim *FluidSim) Recenter() int {
+	var cx, cy float64
+	finite := 0
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		if isFinite(p.X) && isFinite(p.Y) {
+			cx += p.X
+			cy += p.Y
+			finite++
+		}
+	}
+	var shiftX, shiftY float64
+	if finite > 0 {
+		cx, cy = cx/float64(finite), cy/float64(finite)
+		if !sim.Domain.Contains(cx, cy) {
+			centerX, centerY := sim.Domain.Center()
+			shiftX, shiftY = centerX-cx, centerY-cy
+		}
+	}
+
+	moved := 0
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		if sim.Domain.Contains(p.X, p.Y) && shiftX == 0 && shiftY == 0 {
+			continue
+		}
+		wasOutside := !sim.Domain.Contains(p.X, p.Y)
+		if !isFinite(p.X) || !isFinite(p.Y) {
+			p.X, p.Y = sim.Domain.randomPoint()
+		} else {
+			p.X += shiftX
+			p.Y += shiftY
+			if !sim.Domain.Contains(p.X, p.Y) {
+				p.X = math.Max(0, math.Min(p.X, sim.Domain.X-spatial.EPSILON))
+				p.Y = math.Max(0, math.Min(p.Y, sim.Domain.Y-spatial.EPSILON))
+				if sim.Domain.Shape == Circle {
+					sim.Domain.confineCircle(&p.X, &p.Y)
+				}
+			}
+		}
+		if wasOutside {
+			p.Vx, p.Vy = 0, 0
+			moved++
+		}
+	}
+	return moved
+}
+
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
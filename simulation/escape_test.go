@@ -0,0 +1,73 @@
+package simulation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEscapedFractionCountsLostParticles(t *testing.T) {
+	sim := NewFluidSim(10, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Particles[0].X = -5
+	sim.Particles[1].Y = 30
+	sim.Particles[2].X = math.NaN()
+	if got := sim.escapedFraction(); got != 0.3 {
+		t.Errorf("escaped fraction is %g, want 0.3", got)
+	}
+}
+
+func TestRecenterBringsADriftedFluidBack(t *testing.T) {
+	domain := Domain{X: 20, Y: 20}
+	sim := NewFluidSim(9, domain, 0.0005, 1, 1)
+	// a 3x3 block that has drifted well off the right edge
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 50 + float64(i%3), 5 + float64(i/3), 40, 0
+	})
+	sim.Particles[4].Y = math.Inf(1)
+
+	if moved := sim.Recenter(); moved != 9 {
+		t.Errorf("Recenter moved %d particles, want all 9", moved)
+	}
+	for i, p := range sim.Particles {
+		if !domain.Contains(p.X, p.Y) {
+			t.Errorf("particle %d is still outside at (%g, %g)", i, p.X, p.Y)
+		}
+		if p.Vx != 0 || p.Vy != 0 {
+			t.Errorf("particle %d was brought back still moving at (%g, %g)", i, p.Vx, p.Vy)
+		}
+	}
+	// the block keeps its shape
+	if dx := sim.Particles[2].X - sim.Particles[0].X; math.Abs(dx-2) > 1e-9 {
+		t.Errorf("block width changed to %g, want 2", dx)
+	}
+}
+
+func TestRecenterLeavesAFluidInsideAlone(t *testing.T) {
+	sim := NewFluidSim(20, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Particles[0].X, sim.Particles[0].Vx = 25, 3
+	x, y := sim.Particles[1].X, sim.Particles[1].Y
+
+	if moved := sim.Recenter(); moved != 1 {
+		t.Errorf("Recenter moved %d particles, want only the straggler", moved)
+	}
+	if p := sim.Particles[0]; p.X > 20 || p.Vx != 0 {
+		t.Errorf("straggler left at x %g moving at %g", p.X, p.Vx)
+	}
+	if p := sim.Particles[1]; p.X != x || p.Y != y {
+		t.Errorf("a particle inside the domain was moved")
+	}
+}
+
+func TestAdvanceRecentersPastTheThreshold(t *testing.T) {
+	sim := NewFluidSim(10, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.AutoRecenter = true
+	for i := 0; i < 5; i++ {
+		sim.Particles[i].X = math.NaN()
+	}
+	sim.Advance(0, 10000, 0.0005)
+	if sim.EscapedFraction != 0.5 {
+		t.Errorf("escaped fraction is %g, want 0.5 recorded before recentering", sim.EscapedFraction)
+	}
+	if got := sim.escapedFraction(); got != 0 {
+		t.Errorf("after recentering %g of the particles are still outside", got)
+	}
+}
@@ -0,0 +1,97 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"image"
+	"image/color"
+	"math"
+)
+
+// RenderPressureField samples the SPH interpolated pressure,
+// P(x) = sum_j m_j P_j / rho_j W(|x - x_j|), at the center of each pixel of a
+// w by h image stretched over the domain, finding nearby particles through
+// the grid. Sampled pressures are mapped linearly onto gray levels 1 (lowest)
+// to 255 (highest); pixels no particle reaches are left black.
+func RenderPressureField(sim *FluidSim, w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	sim.Grid.Update(sim.Particles)
+
+	values := make([]float64, w*h)
+	covered := make([]bool, w*h)
+	radius := sim.InteractionRadius
+	sim.parallelRange(0, h, func(_, lo, hi int) {
+		var candidates []int
+		for py := lo; py < hi; py++ {
+			y := (float64(py) + 0.5) / float64(h) * sim.Domain.Y
+			for px := 0; px < w; px++ {
+				x := (float64(px) + 0.5) / float64(w) * sim.Domain.X
+				candidates = sim.Grid.GetNeighborParticles(x, y, candidates[:0])
+				pressure := 0.0
+				for _, j := range candidates {
+					p := &sim.Particles[j]
+					weight := spatial.SmoothingKernel(radius, math.Hypot(p.X-x, p.Y-y))
+					if weight == 0 || p.Density == 0 {
+						continue
+					}
+					pressure += p.Mass * p.Pressure / p.Density * weight
+					covered[py*w+px] = true
+				}
+				values[py*w+px] = pressure
+			}
+		}
+	})
+
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for i, v := range values {
+		if covered[i] {
+			lowest = math.Min(lowest, v)
+			highest = math.Max(highest, v)
+		}
+	}
+	for i, v := range values {
+		if !covered[i] {
+			continue
+		}
+		level := 255.0
+		if highest > lowest {
+			level = 1 + 254*(v-lowest)/(highest-lowest)
+		}
+		img.SetGray(i%w, i/w, color.Gray{Y: uint8(math.Round(level))})
+	}
+	return img
+}
+
+// ColumnPressureProfile is a hydrostatic probe: it takes the particles
+// within one interaction radius of the vertical line at x, bins them by
+// depth into bins equal bands from the top of the domain to the bottom, and
+// returns the mean pressure in each band, NaN for bands holding none. In a
+// pool at rest under gravity the pressure should rise linearly with depth
+// below the surface; a profile that bends or stays flat shows the pressure
+// force and rest density aren't what is holding the pool up.
+func (sim *FluidSim) ColumnPressureProfile(x float64, bins int) []float64 {
+	if bins < 1 {
+		return nil
+	}
+	sums := make([]float64, bins)
+	counts := make([]int, bins)
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		if math.Abs(p.X-x) > sim.InteractionRadius || !(p.Y >= 0 && p.Y <= sim.Domain.Y) {
+			continue
+		}
+		b := int(p.Y / sim.Domain.Y * float64(bins))
+		if b == bins {
+			b--
+		}
+		sums[b] += p.Pressure
+		counts[b]++
+	}
+	for b := range sums {
+		if counts[b] == 0 {
+			sums[b] = math.NaN()
+		} else {
+			sums[b] /= float64(counts[b])
+		}
+	}
+	return sums
+}
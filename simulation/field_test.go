@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+	"testing"
+)
+
+func TestRenderPressureField(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 40, Y: 20}, 0.0005, 1, 1)
+	// a low pressure blob on the left, a high pressure one in the middle,
+	// and nothing on the right
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			x, y := 4+float64(i), 8+float64(j)
+			sim.Particles = append(sim.Particles,
+				core.Particle{X: x, Y: y, Mass: 1, Density: 1, Pressure: 10},
+				core.Particle{X: x + 14, Y: y, Mass: 1, Density: 1, Pressure: 100},
+			)
+		}
+	}
+
+	img := RenderPressureField(sim, 40, 20)
+	low, high, empty := img.GrayAt(6, 10).Y, img.GrayAt(20, 10).Y, img.GrayAt(35, 10).Y
+	if empty != 0 {
+		t.Errorf("empty region has level %d, want black", empty)
+	}
+	if low == 0 || high <= low {
+		t.Errorf("low pressure blob at level %d, high at %d; want 0 < low < high", low, high)
+	}
+	if high != 255 {
+		t.Errorf("highest pressure maps to %d, want 255", high)
+	}
+}
+
+func TestColumnPressureProfileBinsByDepth(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 40, Y: 40}, 0.0005, 1, 1)
+	// only the binning is under test here: a made-up pool filling the bottom three quarters, pressure rising
+	// 3 per unit of depth below its surface at y = 10
+	for y := 10.5; y < 40; y++ {
+		for x := 0.5; x < 40; x++ {
+			sim.Particles = append(sim.Particles, core.Particle{X: x, Y: y, Mass: 1, Pressure: 3 * (y - 10)})
+		}
+	}
+	// and a particle outside the column that would spoil its band
+	sim.Particles = append(sim.Particles, core.Particle{X: 35, Y: 5, Pressure: 1e6})
+
+	profile := sim.ColumnPressureProfile(10, 8)
+	if len(profile) != 8 {
+		t.Fatalf("got %d bins, want 8", len(profile))
+	}
+	for b := 0; b < 2; b++ {
+		if !math.IsNaN(profile[b]) {
+			t.Errorf("band %d above the surface has mean pressure %v, want NaN", b, profile[b])
+		}
+	}
+	// each band is 5 deep, so the means step up by 15
+	for b := 2; b < 8; b++ {
+		want := 3 * (float64(b)*5 + 2.5 - 10)
+		if math.Abs(profile[b]-want) > 1e-9 {
+			t.Errorf("band %d mean pressure %v, want %v", b, profile[b], want)
+		}
+	}
+}
+
+func TestColumnPressureProfileOfSettledPool(t *testing.T) {
+	// 200 particles dropped as a block settle into a pool about 8 deep.
+	// Gravity g pulls with acceleration rho g and the standard pressure
+	// force pushes back with grad P / rho, so at rest pressure rises by
+	// rho^2 g per unit of depth. The density repulsion is off; with it the
+	// pool never comes to rest
+	sim := NewFluidSim(200, Domain{X: 20, Y: 12}, 0.002, 1, 4)
+	sim.CorrectPressureForce, sim.CorrectViscosityForce, sim.NoDensityRepulsion = true, true, true
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		p.X, p.Y, p.Vx, p.Vy = float64(i%20)+0.5, 11.5-float64(i/20), 0, 0
+	}
+	g := 10.0
+	for s := 0; s < 1500; s++ {
+		sim.Advance(-g, 2000, sim.Dt)
+	}
+	if speed := math.Sqrt(2 * sim.KineticEnergy() / 200); speed > 0.5 {
+		t.Fatalf("pool still moving at rms speed %v", speed)
+	}
+	var rho float64
+	for _, p := range sim.Particles {
+		rho += p.Density
+	}
+	rho /= 200
+
+	// bands are 2 deep; skip the surface band, which is only partly full
+	profile := sim.ColumnPressureProfile(10, 6)
+	top := 0
+	for top < len(profile) && math.IsNaN(profile[top]) {
+		top++
+	}
+	if len(profile)-top < 4 {
+		t.Fatalf("pool fills only %d bands: %v", len(profile)-top, profile)
+	}
+	want := 2 * rho * rho * g
+	var steps []float64
+	for b := top + 2; b < len(profile); b++ {
+		steps = append(steps, profile[b]-profile[b-1])
+	}
+	for i, step := range steps {
+		// measured about 30% above rho^2 g, the walls and floor thinning
+		// the density near them
+		if step < 0.5*want || step > 1.5*want {
+			t.Errorf("pressure rises by %.1f across band %d, want %.1f within 50%%: %v", step, top+2+i, want, profile)
+		}
+		if d := step - steps[0]; math.Abs(d) > 0.25*steps[0] {
+			t.Errorf("pressure rises by %.1f then %.1f, not linearly: %v", steps[0], step, profile)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package simulation
+
+import "math"
+
+// cross returns the z component of (b - a) x (c - a). It is negative on the
+// side of the line a -> b that the normal (by-ay, ax-bx) points to.
+func cross(ax, ay, bx, by, cx, cy float64) float64 {
+	return (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+}
+
+// FluxAcross returns the net momentum carried across the segment (x1, y1) ->
+// (x2, y2) during the last step, judged from each particle's previous and
+// current position. A particle crossing contributes the component of its
+// (unit mass) velocity along the segment normal (y2-y1, x1-x2): positive when
+// it crosses in the direction of the normal, negative when it crosses back.
+// Call it once per step to accumulate a running flux.
+func (sim *FluidSim) FluxAcross(x1, y1, x2, y2 float64) float64 {
+	length := math.Hypot(x2-x1, y2-y1)
+	if length == 0 {
+		return 0
+	}
+	nx, ny := (y2-y1)/length, (x1-x2)/length
+
+	flux := 0.0
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		before := cross(x1, y1, x2, y2, p.PrevX, p.PrevY)
+		after := cross(x1, y1, x2, y2, p.X, p.Y)
+		if (before < 0) == (after < 0) {
+			continue
+		}
+		// the particle's path must also straddle the segment's own line
+		// for the crossing to fall within the segment
+		if (cross(p.PrevX, p.PrevY, p.X, p.Y, x1, y1) < 0) == (cross(p.PrevX, p.PrevY, p.X, p.Y, x2, y2) < 0) {
+			continue
+		}
+		normalSpeed := math.Abs(p.Vx*nx + p.Vy*ny)
+		if after > 0 {
+			normalSpeed = -normalSpeed
+		}
+		flux += normalSpeed
+	}
+	return flux
+}
@@ -0,0 +1,30 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestFluxAcrossCountsDirection(t *testing.T) {
+	sim := &FluidSim{Particles: []core.Particle{
+		// crosses x=50 moving right
+		{PrevX: 49, PrevY: 50, X: 51, Y: 50, Vx: 2},
+		// crosses moving right, slower
+		{PrevX: 49.5, PrevY: 40, X: 50.5, Y: 40, Vx: 1},
+		// crosses moving left
+		{PrevX: 51, PrevY: 60, X: 49, Y: 60, Vx: -2},
+		// crosses the line x=50 but outside the segment
+		{PrevX: 49, PrevY: 90, X: 51, Y: 90, Vx: 2},
+		// doesn't cross
+		{PrevX: 10, PrevY: 50, X: 12, Y: 50, Vx: 2},
+	}}
+
+	// segment along +y, so its normal (y2-y1, x1-x2) points along +x
+	flux := sim.FluxAcross(50, 30, 50, 70)
+	if flux != 1 {
+		t.Errorf("flux = %v, want 2 + 1 - 2 = 1", flux)
+	}
+	if reversed := sim.FluxAcross(50, 70, 50, 30); reversed != -1 {
+		t.Errorf("flux across reversed segment = %v, want -1", reversed)
+	}
+}
@@ -0,0 +1,68 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+)
+
+// ApplyContactFriction damps sliding between touching particles, those
+// closer than the sum of their radii. Each touching pair loses a Friction
+// fraction of its relative tangential velocity, split by mass so momentum is
+// kept, and leaves the normal velocity alone. Unlike viscosity, which blends
+// velocities smoothly over the whole kernel, this only acts on contacts, so
+// high friction locks packed particles into clumps that move together. A
+// particle's share is divided among its contacts so many at once don't
+// overshoot, and friction spreads through a large clump over a number of
+// steps. The grid must be current.
+func (sim *FluidSim) ApplyContactFriction() {
+	if sim.Friction <= 0 {
+		return
+	}
+	n := len(sim.Particles)
+	neighbors := sim.neighborIndexLists()
+	touching := func(p, q *core.Particle) bool {
+		dx, dy := sim.separation(p, q)
+		r := p.Radius + q.Radius
+		return dx*dx+dy*dy < r*r
+	}
+
+	contacts := make([]int, n)
+	sim.parallelFor(0, n, func(i int) {
+		for _, j := range neighbors[i] {
+			if touching(&sim.Particles[i], &sim.Particles[j]) {
+				contacts[i]++
+			}
+		}
+	})
+
+	dv := make([]core.Vector, n)
+	sim.parallelFor(0, n, func(i int) {
+		p := &sim.Particles[i]
+		for _, j := range neighbors[i] {
+			q := &sim.Particles[j]
+			if !touching(p, q) {
+				continue
+			}
+			dx, dy := sim.separation(p, q)
+			d := math.Hypot(dx, dy)
+			if d == 0 {
+				continue
+			}
+			nx, ny := dx/d, dy/d
+			rx, ry := p.Vx-q.Vx, p.Vy-q.Vy
+			rn := rx*nx + ry*ny
+			tx, ty := rx-rn*nx, ry-rn*ny
+			share := contacts[i]
+			if contacts[j] > share {
+				share = contacts[j]
+			}
+			scale := sim.Friction * q.Mass / (p.Mass + q.Mass) / float64(share)
+			dv[i].X -= scale * tx
+			dv[i].Y -= scale * ty
+		}
+	})
+	sim.parallelFor(0, n, func(i int) {
+		sim.Particles[i].Vx += dv[i].X
+		sim.Particles[i].Vy += dv[i].Y
+	})
+}
@@ -0,0 +1,89 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+	"testing"
+)
+
+// slidingPair places two touching particles side by side moving past each
+// other vertically.
+func slidingPair(friction float64) *FluidSim {
+	sim := NewFluidSim(2, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Friction = friction
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 9.25 + 1.5*float64(i), 10, 0, 3 - 6*float64(i)
+	})
+	sim.Grid.Update(sim.Particles)
+	return sim
+}
+
+func TestFullContactFrictionStopsSliding(t *testing.T) {
+	sim := slidingPair(1)
+	sim.ApplyContactFriction()
+	a, b := sim.Particles[0], sim.Particles[1]
+	if math.Abs(a.Vy-b.Vy) > 1e-12 {
+		t.Errorf("touching particles still slide at %g and %g", a.Vy, b.Vy)
+	}
+	if math.Abs(a.Vy+b.Vy) > 1e-12 {
+		t.Errorf("friction changed the pair's momentum: velocities %g and %g", a.Vy, b.Vy)
+	}
+}
+
+func TestContactFrictionActsAcrossAPeriodicEdge(t *testing.T) {
+	sim := NewFluidSim(2, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.LeftBoundary = spatial.Periodic
+	sim.Friction = 1
+	// 1 apart through the left/right edge, sliding past each other
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 0.5 + 19*float64(i), 10, 0, 1 - 2*float64(i)
+	})
+	sim.Grid.Update(sim.Particles)
+	sim.ApplyContactFriction()
+	a, b := sim.Particles[0], sim.Particles[1]
+	if math.Abs(a.Vy) > 1e-12 || math.Abs(b.Vy) > 1e-12 {
+		t.Errorf("particles touching across the edge still slide at %g and %g", a.Vy, b.Vy)
+	}
+}
+
+func TestZeroFrictionLeavesVelocitiesAlone(t *testing.T) {
+	sim := slidingPair(0)
+	sim.ApplyContactFriction()
+	if sim.Particles[0].Vy != 3 || sim.Particles[1].Vy != -3 {
+		t.Errorf("zero friction changed velocities to %g and %g", sim.Particles[0].Vy, sim.Particles[1].Vy)
+	}
+}
+
+func TestHighFrictionMovesAClumpTogether(t *testing.T) {
+	sim := NewFluidSim(49, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Friction = 1
+	// a 7x7 block of touching particles with a shear across it
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		col, row := float64(i%7), float64(i/7)
+		return 4 + 1.8*col, 4 + 1.8*row, 2 * (row - 3), 0
+	})
+	sim.Grid.Update(sim.Particles)
+	before := velocitySpread(sim)
+	for i := 0; i < 100; i++ {
+		sim.ApplyContactFriction()
+	}
+	if after := velocitySpread(sim); after > before/10 {
+		t.Errorf("velocity spread went from %g to %g, want the block moving as one", before, after)
+	}
+}
+
+// velocitySpread is the RMS deviation of the velocities from their mean.
+func velocitySpread(sim *FluidSim) float64 {
+	var mx, my float64
+	for _, p := range sim.Particles {
+		mx += p.Vx
+		my += p.Vy
+	}
+	n := float64(len(sim.Particles))
+	mx, my = mx/n, my/n
+	var sum float64
+	for _, p := range sim.Particles {
+		sum += (p.Vx-mx)*(p.Vx-mx) + (p.Vy-my)*(p.Vy-my)
+	}
+	return math.Sqrt(sum / n)
+}
@@ -0,0 +1,159 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+)
+
+// MaterialModel selects the force model particles interact with.
+type MaterialModel int
+
+const (
+	// Fluid is SPH: pressure, viscosity, and density repulsion.
+	Fluid MaterialModel = iota
+	// Granular drops the fluid forces for a contact model between grains:
+	// short-range spring-dashpot repulsion plus Coulomb friction, so poured
+	// grains heap up at an angle of repose instead of leveling out.
+	Granular
+)
+
+func (m MaterialModel) String() string {
+	if m == Granular {
+		return "granular"
+	}
+	return "fluid"
+}
+
+// granular contact defaults. The stiffness is about the largest that stays
+// stable at the default time step, which keeps grains in a heap a few layers
+// deep overlapping by a fraction of their radius under the default gravity;
+// damping is a fraction of critical damping.
+const (
+	defaultGranularStiffness = 4e5
+	defaultGranularDamping   = 0.3
+	defaultGranularFriction  = 0.6
+)
+
+// granularContact is one touching neighbor, or a wall when j is -1: the
+// contact normal pointing toward the particle and the normal force.
+type granularContact struct {
+	j        int
+	nx, ny   float64
+	force    float64
+	friction float64 // along the tangent (-ny, nx)
+}
+
+// UpdateGranularForces replaces UpdateForces for Granular material. Grains
+// touch when their centers are closer than the sum of their radii, and the
+// walls count as grains of infinite mass. Each contact pushes with a
+// spring-dashpot normal force, and friction then opposes the sliding velocity
+// the contact would have after this step, capped at GranularFriction times
+// the normal force. Cancelling the predicted sliding, rather than resisting
+// the current one, is what lets a slope hold still instead of creeping.
+// Gravity is weighted by density as in UpdateForces.
+func (sim *FluidSim) UpdateGranularForces(gravity, dt float64) {
+	n := len(sim.Particles)
+	neighbors := sim.neighborIndexLists()
+	contacts := make([][]granularContact, n)
+	damping := 2 * sim.GranularDamping * math.Sqrt(sim.GranularStiffness)
+
+	sim.parallelFor(0, n, func(i int) {
+		p := &sim.Particles[i]
+		p.Force = core.Vector{X: 0, Y: -p.Density * gravity}
+		var list []granularContact
+		for _, j := range neighbors[i] {
+			q := &sim.Particles[j]
+			dx, dy := sim.separation(p, q)
+			d := math.Hypot(dx, dy)
+			overlap := p.Radius + q.Radius - d
+			if overlap <= 0 || d == 0 {
+				continue
+			}
+			nx, ny := dx/d, dy/d
+			vn := (p.Vx-q.Vx)*nx + (p.Vy-q.Vy)*ny
+			list = append(list, granularContact{j: j, nx: nx, ny: ny, force: math.Max(0, sim.GranularStiffness*overlap-damping*vn)})
+		}
+		list = sim.appendWallContacts(p, list, damping)
+		for _, c := range list {
+			p.Force.X += c.force * c.nx / p.Mass
+			p.Force.Y += c.force * c.ny / p.Mass
+		}
+		contacts[i] = list
+	})
+
+	// friction is solved by Jacobi iteration: each pass nudges every
+	// contact's tangential force toward stopping its predicted slip, sharing
+	// the correction between a grain's contacts so the nudges don't overshoot
+	friction := make([]core.Vector, n)
+	for iter := 0; iter < granularFrictionIterations; iter++ {
+		sim.parallelFor(0, n, func(i int) {
+			p := &sim.Particles[i]
+			vx, vy := sim.predictedVelocity(i, friction[i], dt)
+			for k := range contacts[i] {
+				c := &contacts[i][k]
+				// slip along the tangent (-ny, nx), and how easily the contact changes it
+				slip := -vx*c.ny + vy*c.nx
+				invMass := 1 / p.Mass
+				share := len(contacts[i])
+				if c.j >= 0 {
+					qx, qy := sim.predictedVelocity(c.j, friction[c.j], dt)
+					slip -= -qx*c.ny + qy*c.nx
+					invMass += 1 / sim.Particles[c.j].Mass
+					if len(contacts[c.j]) > share {
+						share = len(contacts[c.j])
+					}
+				}
+				limit := sim.GranularFriction * c.force
+				c.friction = math.Max(-limit, math.Min(limit, c.friction-slip/(invMass*dt*float64(share))))
+			}
+		})
+		sim.parallelFor(0, n, func(i int) {
+			var sum core.Vector
+			for _, c := range contacts[i] {
+				sum.X -= c.friction * c.ny
+				sum.Y += c.friction * c.nx
+			}
+			friction[i] = sum
+		})
+	}
+	sim.parallelFor(0, n, func(i int) {
+		p := &sim.Particles[i]
+		p.Force.X += friction[i].X / p.Mass
+		p.Force.Y += friction[i].Y / p.Mass
+	})
+}
+
+// granularFrictionIterations is enough Jacobi passes for friction to hold a
+// heap still rather than let it creep a little every step.
+const granularFrictionIterations = 8
+
+// predictedVelocity is particle i's velocity after this step under its
+// current force plus the given friction force.
+func (sim *FluidSim) predictedVelocity(i int, friction core.Vector, dt float64) (float64, float64) {
+	p := &sim.Particles[i]
+	return p.Vx + (p.Force.X+friction.X/p.Mass)*dt, p.Vy + (p.Force.Y+friction.Y/p.Mass)*dt
+}
+
+// appendWallContacts adds a contact for each reflective wall of a
+// rectangular domain the grain overlaps.
+func (sim *FluidSim) appendWallContacts(p *core.Particle, list []granularContact, damping float64) []granularContact {
+	if sim.Domain.Shape != Rect {
+		return list
+	}
+	wall := func(overlap, nx, ny float64) {
+		if overlap > 0 {
+			vn := p.Vx*nx + p.Vy*ny
+			list = append(list, granularContact{j: -1, nx: nx, ny: ny, force: math.Max(0, sim.GranularStiffness*overlap-damping*vn)})
+		}
+	}
+	if sim.LeftBoundary == spatial.Reflective {
+		wall(p.Radius-p.X, 1, 0)
+		wall(p.X+p.Radius-sim.Domain.X, -1, 0)
+	}
+	if sim.TopBoundary == spatial.Reflective {
+		wall(p.Radius-p.Y, 0, 1)
+		wall(p.Y+p.Radius-sim.Domain.Y, 0, -1)
+	}
+	return list
+}
@@ -0,0 +1,83 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+	"testing"
+)
+
+// pourColumn drops a column of grains cols wide and rows tall, stacked on the
+// floor in the middle of a wide box.
+func pourColumn(friction float64, cols, rows int) *FluidSim {
+	domain := Domain{X: 60, Y: 40}
+	sim := NewFluidSim(cols*rows, domain, 0.0005, 1, 1)
+	sim.Material = Granular
+	sim.GranularFriction = friction
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		// alternate rows are nudged sideways so the column topples
+		col, row := float64(i%cols), float64(i/cols)
+		x := domain.X/2 - float64(cols) + 1 + 2*col + 0.1*float64(i/cols%2)
+		return x, domain.Y - 1 - 2*row, 0, 0
+	})
+	return sim
+}
+
+func pileHeight(sim *FluidSim) float64 {
+	top := sim.Domain.Y
+	for _, p := range sim.Particles {
+		top = math.Min(top, p.Y-p.Radius)
+	}
+	return sim.Domain.Y - top
+}
+
+func TestGrainsCollideAcrossAPeriodicEdge(t *testing.T) {
+	sim := NewFluidSim(2, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Material = Granular
+	sim.LeftBoundary = spatial.Periodic
+	// overlapping by 0.8 through the left/right edge
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 0.6 + 18.8*float64(i), 10, 0, 0
+	})
+	sim.Grid.Update(sim.Particles)
+	sim.UpdateGranularForces(0, 0.0005)
+	// each is pushed away from the other's image, out through its own edge
+	if a, b := sim.Particles[0].Force.X, sim.Particles[1].Force.X; a <= 0 || b >= 0 {
+		t.Errorf("contact forces %g and %g, want the grains pushed apart across the edge", a, b)
+	}
+}
+
+func TestGranularFrictionHoldsASlope(t *testing.T) {
+	const cols, rows = 6, 15
+	heights := map[float64]float64{}
+	for _, friction := range []float64{0, defaultGranularFriction} {
+		sim := pourColumn(friction, cols, rows)
+		for step := 0; step < 2000; step++ {
+			sim.Advance(-100000, 10000, 0.0005)
+		}
+		heights[friction] = pileHeight(sim)
+	}
+
+	// 90 grains spread over the 60-wide floor lie about three deep
+	if flat := heights[0]; flat > 8 {
+		t.Errorf("frictionless grains stand %.2f high, want them spread flat", flat)
+	}
+	if pile, flat := heights[defaultGranularFriction], heights[0]; pile < flat+2 {
+		t.Errorf("grains with friction stand %.2f high, want a heap clearly above the frictionless %.2f", pile, flat)
+	}
+}
+
+func TestGranularContactsPushApart(t *testing.T) {
+	sim := NewFluidSim(2, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Material = Granular
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 9.5 + float64(i), 10, 0, 0
+	})
+	sim.Advance(0, 10000, 0.0005)
+	a, b := sim.Particles[0], sim.Particles[1]
+	if !(a.Vx < 0 && b.Vx > 0) {
+		t.Fatalf("overlapping grains move at %g and %g, want them pushed apart", a.Vx, b.Vx)
+	}
+	if math.Abs(a.Vx+b.Vx) > 1e-9 {
+		t.Errorf("contact is not symmetric: velocities %g and %g", a.Vx, b.Vx)
+	}
+}
@@ -0,0 +1,32 @@
+package simulation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteNeighborGraph writes the neighbor graph as an edge list, one "i j"
+// line per pair of particles closer than InteractionRadius, with i < j so
+// every pair appears once. Edges are ordered by i, then j. Particle indices
+// are positions in sim.Particles. The grid is rebuilt first, so it reflects
+// the current positions and radius.
+func (sim *FluidSim) WriteNeighborGraph(w io.Writer) error {
+	sim.Grid.Update(sim.Particles)
+	lists := sim.neighborIndexLists()
+
+	buf := bufio.NewWriter(w)
+	for i, neighbors := range lists {
+		sort.Ints(neighbors)
+		for _, j := range neighbors {
+			if j <= i {
+				continue
+			}
+			if _, err := fmt.Fprintf(buf, "%d %d\n", i, j); err != nil {
+				return err
+			}
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,36 @@
+package simulation
+
+import (
+	"bytes"
+	"fluids/core"
+	"testing"
+)
+
+func TestWriteNeighborGraph(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{
+		{X: 10, Y: 10},
+		{X: 12, Y: 10}, // 2 from particle 0
+		{X: 10, Y: 13}, // 3 from 0, sqrt(13) from 1
+		{X: 50, Y: 50}, // isolated
+	}
+
+	var buf bytes.Buffer
+	if err := sim.WriteNeighborGraph(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "0 1\n0 2\n1 2\n"; got != want {
+		t.Errorf("radius 4 graph:\n%s\nwant:\n%s", got, want)
+	}
+
+	// shrinking the radius drops the longer edges
+	sim.InteractionRadius = 2.5
+	sim.SetGridType(sim.GridType)
+	buf.Reset()
+	if err := sim.WriteNeighborGraph(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "0 1\n"; got != want {
+		t.Errorf("radius 2.5 graph:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package simulation
+
+import "math"
+
+// histogramTailFactor sets the default histogram range as a multiple of the
+// mean speed, wide enough for the bulk of the fluid while a long tail of fast
+// particles still stands out in the last bin.
+const histogramTailFactor = 4
+
+// SpeedHistogram counts particles by speed in bins equal-width bins over
+// [0, maxSpeed). Speeds of maxSpeed and above land in the last bin, so the
+// fast tail is always counted. A maxSpeed of 0 or less uses
+// histogramTailFactor times the mean speed. Workers count into private
+// histograms that are summed afterwards.
+func (sim *FluidSim) SpeedHistogram(bins int, maxSpeed float64) []int {
+	if bins < 1 {
+		return nil
+	}
+	counts := make([]int, bins)
+	n := len(sim.Particles)
+	if n == 0 {
+		return counts
+	}
+	speed := func(i int) float64 {
+		return math.Hypot(sim.Particles[i].Vx, sim.Particles[i].Vy)
+	}
+	if maxSpeed <= 0 {
+		maxSpeed = histogramTailFactor * sim.parallelReduce(0, n, 0, speed, sum) / float64(n)
+	}
+
+	partial := make([][]int, sim.parallel().workerCount(n))
+	sim.parallelRange(0, n, func(w, lo, hi int) {
+		local := make([]int, bins)
+		for i := lo; i < hi; i++ {
+			bin := bins - 1
+			if maxSpeed > 0 {
+				if b := int(speed(i) / maxSpeed * float64(bins)); b < bins {
+					bin = b
+				}
+			}
+			local[bin]++
+		}
+		partial[w] = local
+	})
+	for _, local := range partial {
+		for b, c := range local {
+			counts[b] += c
+		}
+	}
+	return counts
+}
@@ -0,0 +1,43 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestSpeedHistogramBinsAndTail(t *testing.T) {
+	speeds := []float64{0, 0.5, 1.5, 2.5, 3.9, 4, 100}
+	sim := &FluidSim{Particles: make([]core.Particle, len(speeds))}
+	for i, s := range speeds {
+		sim.Particles[i].Vy = s
+	}
+	got := sim.SpeedHistogram(4, 4)
+	want := []int{2, 1, 1, 3} // 4 and 100 are past the range and join the last bin
+	for b := range want {
+		if got[b] != want[b] {
+			t.Fatalf("histogram %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSpeedHistogramMatchesAcrossWorkers(t *testing.T) {
+	sim := &FluidSim{Particles: make([]core.Particle, 1000)}
+	for i := range sim.Particles {
+		sim.Particles[i].Vx = float64(i%37) * 0.3
+	}
+	sim.Parallel = ParallelConfig{NumWorkers: 1, MinimumBatchSize: 1}
+	serial := sim.SpeedHistogram(10, 0)
+	sim.Parallel = ParallelConfig{NumWorkers: 8, MinimumBatchSize: 1}
+	parallel := sim.SpeedHistogram(10, 0)
+
+	total := 0
+	for b := range serial {
+		if serial[b] != parallel[b] {
+			t.Fatalf("parallel histogram %v, serial %v", parallel, serial)
+		}
+		total += serial[b]
+	}
+	if total != len(sim.Particles) {
+		t.Errorf("histogram counts %d particles, want %d", total, len(sim.Particles))
+	}
+}
@@ -0,0 +1,56 @@
+package simulation
+
+import "math"
+
+// ApplyRadialImpulse kicks every particle within radius of (x, y) directly
+// away from it, adding force to its speed regardless of distance. A particle
+// exactly at the center has no direction and is left alone. It returns the
+// IDs of the particles it kicked.
+func (sim *FluidSim) ApplyRadialImpulse(x, y, force, radius float64) []int {
+	var kicked []int
+	sim.applyRadial(x, y, radius, func(float64) float64 { return force }, func(id int) {
+		kicked = append(kicked, id)
+	})
+	return kicked
+}
+
+// ApplyGravityWell pulls every particle within radius of (x, y) toward it
+// for dt, with an acceleration of strength / r^2. The falloff is softened
+// over one interaction radius, so the pull levels off at strength / h^2
+// near the center instead of flinging out a particle that passes through
+// it. Applied every step, it is an attractor that can be moved around.
+func (sim *FluidSim) ApplyGravityWell(x, y, strength, radius, dt float64) {
+	soft := sim.InteractionRadius * sim.InteractionRadius
+	sim.applyRadial(x, y, radius, func(r float64) float64 {
+		return -strength * dt / (r*r + soft)
+	}, nil)
+}
+
+// applyRadial changes the velocity of every particle within radius of
+// (x, y) by kick(r) directly away from it, r being the particle's distance;
+// a negative kick pulls inward. A particle exactly at the center has no
+// direction and is left alone. hit, if set, is called with the ID of each
+// particle kicked.
+func (sim *FluidSim) applyRadial(x, y, radius float64, kick func(r float64) float64, hit func(id int)) {
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		dx := p.X - x
+		dy := p.Y - y
+
+		distanceSquared := dx*dx + dy*dy
+		if distanceSquared > radius*radius {
+			continue
+		}
+
+		length := math.Sqrt(distanceSquared)
+		if length == 0 {
+			continue
+		}
+		dv := kick(length)
+		p.Vx += dx / length * dv
+		p.Vy += dy / length * dv
+		if hit != nil {
+			hit(p.ID)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+	"testing"
+)
+
+func TestApplyRadialImpulse(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{
+		{ID: 0, X: 50, Y: 50},        // at the center: no direction
+		{ID: 1, X: 53, Y: 54, Vx: 1}, // inside, distance 5
+		{ID: 2, X: 50, Y: 40},        // exactly on the edge
+		{ID: 3, X: 61, Y: 50, Vy: 2}, // outside
+	}
+	kicked := sim.ApplyRadialImpulse(50, 50, 100, 10)
+	if len(kicked) != 2 || kicked[0] != 1 || kicked[1] != 2 {
+		t.Errorf("kicked %v, want [1 2]", kicked)
+	}
+
+	want := []core.Vector{{X: 0, Y: 0}, {X: 1 + 60, Y: 80}, {X: 0, Y: -100}, {X: 0, Y: 2}}
+	for i, p := range sim.Particles {
+		if math.Abs(p.Vx-want[i].X) > 1e-9 || math.Abs(p.Vy-want[i].Y) > 1e-9 {
+			t.Errorf("particle %d: velocity (%v, %v), want (%v, %v)", i, p.Vx, p.Vy, want[i].X, want[i].Y)
+		}
+	}
+}
+
+func TestApplyGravityWell(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	sim.InteractionRadius = 1
+	sim.Particles = []core.Particle{
+		{ID: 0, X: 50, Y: 50},        // at the center: no direction
+		{ID: 1, X: 53, Y: 54, Vx: 1}, // inside, distance 5
+		{ID: 2, X: 50, Y: 40},        // inside, distance 10
+		{ID: 3, X: 80, Y: 50, Vy: 2}, // outside
+	}
+	sim.ApplyGravityWell(50, 50, 2600, 20, 0.1)
+
+	// 2600 * 0.1 / (r^2 + 1): 10 toward the center at distance 5, about 2.57 at 10
+	far := 260.0 / 101
+	want := []core.Vector{{X: 0, Y: 0}, {X: 1 - 6, Y: -8}, {X: 0, Y: far}, {X: 0, Y: 2}}
+	for i, p := range sim.Particles {
+		if math.Abs(p.Vx-want[i].X) > 1e-9 || math.Abs(p.Vy-want[i].Y) > 1e-9 {
+			t.Errorf("particle %d: velocity (%v, %v), want (%v, %v)", i, p.Vx, p.Vy, want[i].X, want[i].Y)
+		}
+	}
+}
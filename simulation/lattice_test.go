@@ -0,0 +1,157 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDamBreakLatticeIsExactWithoutJitter(t *testing.T) {
+	domain := Domain{X: 40, Y: 20}
+	ic := DamBreakInitialCondition(domain, 100, 0)
+	// 100 particles over the 20x20 left half: spacing 2, 10 columns
+	for i := 0; i < 100; i++ {
+		x, y, vx, vy := ic(i, 100)
+		wantX := float64(i%10)*2 + 1
+		wantY := 20 - float64(i/10)*2 - 1
+		if math.Abs(x-wantX) > 1e-9 || math.Abs(y-wantY) > 1e-9 || vx != 0 || vy != 0 {
+			t.Fatalf("particle %d at (%v, %v) moving (%v, %v), want (%v, %v) at rest", i, x, y, vx, vy, wantX, wantY)
+		}
+	}
+}
+
+func TestDamBreakJitterIsReproducible(t *testing.T) {
+	domain := Domain{X: 40, Y: 20}
+	exact := DamBreakInitialCondition(domain, 100, 0)
+	rand.Seed(11)
+	a := DamBreakInitialCondition(domain, 100, 0.2)
+	rand.Seed(11)
+	b := DamBreakInitialCondition(domain, 100, 0.2)
+
+	moved := false
+	for i := 0; i < 100; i++ {
+		ax, ay, _, _ := a(i, 100)
+		bx, by, _, _ := b(i, 100)
+		if ax != bx || ay != by {
+			t.Fatalf("particle %d differs between runs with the same seed", i)
+		}
+		ex, ey, _, _ := exact(i, 100)
+		// at most a tenth of the spacing of 2 in each direction
+		if math.Abs(ax-ex) > 0.2 || math.Abs(ay-ey) > 0.2 {
+			t.Fatalf("particle %d jittered by (%v, %v), beyond ±0.2", i, ax-ex, ay-ey)
+		}
+		moved = moved || ax != ex || ay != ey
+	}
+	if !moved {
+		t.Error("jitter left the lattice exact")
+	}
+}
+
+func TestTaylorGreenMatchesAnalyticField(t *testing.T) {
+	domain := Domain{X: 20, Y: 20}
+	ic := TaylorGreenInitialCondition(domain, 100, 2)
+	k := 2 * math.Pi / 20
+	for i := 0; i < 100; i++ {
+		x, y, vx, vy := ic(i, 100)
+		// 100 particles over 20x20: spacing 2, 10 columns
+		wantX, wantY := float64(i%10)*2+1, float64(i/10)*2+1
+		if math.Abs(x-wantX) > 1e-9 || math.Abs(y-wantY) > 1e-9 {
+			t.Fatalf("particle %d at (%v, %v), want (%v, %v)", i, x, y, wantX, wantY)
+		}
+		wantVx := 2 * math.Sin(k*x) * math.Cos(k*y)
+		wantVy := -2 * math.Cos(k*x) * math.Sin(k*y)
+		if math.Abs(vx-wantVx) > 1e-9 || math.Abs(vy-wantVy) > 1e-9 {
+			t.Fatalf("particle %d moving (%v, %v), want (%v, %v)", i, vx, vy, wantVx, wantVy)
+		}
+	}
+}
+
+func TestTaylorGreenLatticeTilesThePeriodicBox(t *testing.T) {
+	// 120 particles over 20x20: 11 columns and 11 rows, the last partly
+	// filled, so the spacing is 20/11 on both axes and the gap across the
+	// wrap matches the gap inside the box
+	domain := Domain{X: 20, Y: 20}
+	ic := TaylorGreenInitialCondition(domain, 120, 1)
+	d := 20.0 / 11
+	for i := 0; i < 120; i++ {
+		x, y, _, _ := ic(i, 120)
+		wantX, wantY := (float64(i%11)+0.5)*d, (float64(i/11)+0.5)*d
+		if math.Abs(x-wantX) > 1e-9 || math.Abs(y-wantY) > 1e-9 {
+			t.Fatalf("particle %d at (%v, %v), want (%v, %v)", i, x, y, wantX, wantY)
+		}
+	}
+}
+
+func TestTaylorGreenDecaysAtTheViscousRate(t *testing.T) {
+	// kinetic energy of the vortex decays as exp(-2 nu (kx^2 + ky^2) t);
+	// pressure is off, so only viscosity changes it over this short run.
+	// At 400 particles the measured rate is about 13% slow, and closes in
+	// with resolution
+	domain := Domain{X: 20, Y: 20}
+	nu := 4.0
+	sim := NewFluidSim(400, domain, 0.001, 1, nu)
+	sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	sim.CorrectPressureForce, sim.CorrectViscosityForce = true, true
+	sim.ApplyInitialCondition(TaylorGreenInitialCondition(domain, 400, 1))
+	e0 := sim.KineticEnergy()
+	steps := 250
+	for s := 0; s < steps; s++ {
+		sim.Advance(0, 0, sim.Dt)
+	}
+
+	k := 2 * math.Pi / 20
+	want := 2 * nu * 2 * k * k
+	rate := -math.Log(sim.KineticEnergy()/e0) / (float64(steps) * sim.Dt)
+	if math.Abs(rate-want) > 0.25*want {
+		t.Errorf("kinetic energy decayed at rate %.3f, want %.3f within 25%%", rate, want)
+	}
+}
+
+func newTaylorGreenSim() *FluidSim {
+	domain := Domain{X: 20, Y: 20}
+	sim := NewFluidSim(100, domain, 0.001, 1, 1)
+	sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	sim.ApplyInitialCondition(TaylorGreenInitialCondition(domain, 100, 50))
+	return sim
+}
+
+func TestTaylorGreenPeriodicRunIsReproducible(t *testing.T) {
+	a, b := newTaylorGreenSim(), newTaylorGreenSim()
+	for s := 0; s < 20; s++ {
+		a.Advance(0, 100, a.Dt)
+		b.Advance(0, 100, b.Dt)
+	}
+	for i, p := range a.Particles {
+		if p.X < 0 || p.X >= a.Domain.X || p.Y < 0 || p.Y >= a.Domain.Y {
+			t.Fatalf("particle %d left the periodic domain: (%v, %v)", i, p.X, p.Y)
+		}
+	}
+	if pos, vel := Compare(a, b); pos != 0 || vel != 0 {
+		t.Errorf("identical runs diverged by %v in position, %v in velocity", pos, vel)
+	}
+}
+
+func TestPeriodicNeighborsWrapAround(t *testing.T) {
+	sim := NewFluidSim(2, Domain{X: 20, Y: 20}, 0.001, 1, 1)
+	sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	sim.Particles[0].X, sim.Particles[0].Y = 0.5, 0.5
+	sim.Particles[1].X, sim.Particles[1].Y = 19.5, 19.5
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+
+	// the corner image of particle 1 is a distance sqrt(2) from particle 0
+	var across *core.Particle
+	for j := range sim.Particles[0].Neighbors {
+		if sim.Particles[0].Neighbors[j].ID == sim.Particles[1].ID {
+			across = &sim.Particles[0].Neighbors[j]
+		}
+	}
+	if across == nil {
+		t.Fatal("particles on opposite corners are not neighbors")
+	}
+	if across.X != -0.5 || across.Y != -0.5 {
+		t.Errorf("neighbor seen at (%v, %v), want its image at (-0.5, -0.5)", across.X, across.Y)
+	}
+}
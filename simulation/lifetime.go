@@ -0,0 +1,78 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+	"math/rand"
+)
+
+// ageParticles advances the age of every particle with a finite lifetime and
+// removes those past it, compacting the survivors in place in one pass so
+// their order is kept. Particles with MaxAge 0 never age. The grid is
+// updated after a removal, so lookups between steps don't land on indices
+// that are gone.
+//
+// The tiles of a TiledSim leave this to the TiledSim, since removing a
+// particle from a tile would shift the tile slots it maps back from.
+func (sim *FluidSim) ageParticles(dt float64) {
+	if sim.tiled {
+		return
+	}
+	kept := ageParticles(sim.Particles, dt)
+	if len(kept) == len(sim.Particles) {
+		return
+	}
+	sim.Particles = kept
+	sim.N = len(kept)
+	sim.Grid.Update(sim.Particles)
+}
+
+// ageParticles ages the particles with a finite lifetime by dt and returns
+// the slice compacted down to the survivors, in their original order.
+func ageParticles(particles []core.Particle, dt float64) []core.Particle {
+	kept := 0
+	for i := range particles {
+		p := &particles[i]
+		if p.MaxAge > 0 {
+			p.Age += dt
+			if p.Age > p.MaxAge {
+				continue
+			}
+		}
+		if kept != i {
+			particles[kept] = *p
+		}
+		kept++
+	}
+	return particles[:kept]
+}
+
+// EmitSpray spawns count particles around (x, y), scattered within a
+// particle radius so none sit on top of each other, flying outward in random
+// directions at between half and all of speed, each living for maxAge before it is removed;
+// maxAge 0 makes them permanent. It returns how many were added, none when
+// (x, y) is outside the domain.
+func (sim *FluidSim) EmitSpray(x, y float64, count int, speed, maxAge float64) int {
+	if !sim.Domain.Contains(x, y) {
+		return 0
+	}
+	for i := 0; i < count; i++ {
+		angle := 2 * math.Pi * rand.Float64()
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		r := sim.RadiusBase * rand.Float64()
+		s := speed * (0.5 + 0.5*rand.Float64())
+		p := core.Particle{
+			ID: sim.nextID, X: x + r*cos, Y: y + r*sin,
+			Vx: s * cos, Vy: s * sin,
+			Density: sim.Rho0,
+			MaxAge:  maxAge,
+		}
+		sim.nextID++
+		p.R, p.G, p.B = 255, 255, 255
+		p.Neighbors = make([]core.Particle, 0, sim.NeighborCapacityHint)
+		sim.assignRadius(&p)
+		sim.Particles = append(sim.Particles, p)
+	}
+	sim.N = len(sim.Particles)
+	return count
+}
@@ -0,0 +1,56 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestAgeParticlesRemovesExpired(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{
+		{ID: 0, X: 10, Y: 10},
+		{ID: 1, X: 11, Y: 10, MaxAge: 1, Age: 0.95},
+		{ID: 2, X: 12, Y: 10, MaxAge: 1, Age: 0.5},
+		{ID: 3, X: 13, Y: 10, MaxAge: 0.01, Age: 0.2},
+		{ID: 4, X: 14, Y: 10},
+	}
+	sim.ageParticles(0.1)
+
+	var ids []int
+	for _, p := range sim.Particles {
+		ids = append(ids, p.ID)
+	}
+	if len(ids) != 3 || ids[0] != 0 || ids[1] != 2 || ids[2] != 4 || sim.N != 3 {
+		t.Fatalf("survivors %v (N %d), want [0 2 4] in order", ids, sim.N)
+	}
+	if sim.Particles[0].Age != 0 || sim.Particles[2].Age != 0 {
+		t.Errorf("particles without a lifetime aged")
+	}
+	if got := sim.Particles[1].Age; got != 0.6 {
+		t.Errorf("particle 2 is %v old, want 0.6", got)
+	}
+	if got := sim.Grid.GetNeighborParticles(14, 10, nil); len(got) != 3 {
+		t.Errorf("grid lists %v near the survivors after the removal, want all 3", got)
+	}
+}
+
+func TestEmitSprayExpires(t *testing.T) {
+	sim := NewFluidSim(20, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	if added := sim.EmitSpray(25, 25, 10, 50, 0.002); added != 10 || sim.N != 30 {
+		t.Fatalf("added %d for %d particles, want 10 for 30", added, sim.N)
+	}
+	if added := sim.EmitSpray(-5, 25, 10, 50, 0.002); added != 0 {
+		t.Errorf("added %d spray outside the domain", added)
+	}
+	for step := 0; step < 5; step++ {
+		sim.Advance(0, 1000, 0.0005)
+	}
+	if sim.N != 20 {
+		t.Errorf("%d particles after the spray's lifetime, want the 20 permanent ones", sim.N)
+	}
+	for _, p := range sim.Particles {
+		if p.MaxAge != 0 {
+			t.Fatalf("spray particle %d outlived its lifetime", p.ID)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package simulation
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"math/rand"
+	"os"
+)
+
+// maskedPixel reports whether a pixel belongs to the mask: opaque and dark.
+func maskedPixel(img image.Image, x, y int) bool {
+	r, g, b, a := img.At(x, y).RGBA()
+	if a < 0x8000 {
+		return false
+	}
+	luminance := (299*r + 587*g + 114*b) / 1000
+	return luminance < 0x8000
+}
+
+// ImageMaskInitialCondition places n particles at rest inside the opaque, dark
+// pixels of a PNG, with the image stretched over the domain. Masked pixels are
+// taken in raster order at an even stride so the particles cover the whole
+// mask, and each particle lands at a random point within its pixel.
+func ImageMaskInitialCondition(path string, domain Domain, n int) (InitialConditionFunc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding mask %s: %w", path, err)
+	}
+
+	bounds := img.Bounds()
+	var pixels []image.Point
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if maskedPixel(img, x, y) {
+				pixels = append(pixels, image.Point{X: x - bounds.Min.X, Y: y - bounds.Min.Y})
+			}
+		}
+	}
+	if len(pixels) == 0 {
+		return nil, fmt.Errorf("mask %s has no opaque dark pixels", path)
+	}
+	if n > len(pixels) {
+		return nil, fmt.Errorf("mask %s has %d masked pixels, too few for %d particles; use a larger image or fewer particles", path, len(pixels), n)
+	}
+
+	pixelW := domain.X / float64(bounds.Dx())
+	pixelH := domain.Y / float64(bounds.Dy())
+	return func(i, n int) (float64, float64, float64, float64) {
+		p := pixels[i*len(pixels)/n]
+		x := (float64(p.X) + rand.Float64()) * pixelW
+		y := (float64(p.Y) + rand.Float64()) * pixelH
+		return x, y, 0, 0
+	}, nil
+}
@@ -0,0 +1,65 @@
+package simulation
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeMask saves a w x h PNG that is black on its left half and white elsewhere.
+func writeMask(t *testing.T, w, h int) string {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{255, 255, 255, 255}
+			if x < w/2 {
+				c = color.RGBA{0, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "mask.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImageMaskInitialCondition(t *testing.T) {
+	domain := Domain{X: 100, Y: 100}
+	path := writeMask(t, 20, 20)
+
+	ic, err := ImageMaskInitialCondition(path, domain, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewFluidSim(200, domain, 0.0005, 1.0, 1.0)
+	sim.ApplyInitialCondition(ic)
+
+	var top, bottom int
+	for _, p := range sim.Particles {
+		if p.X < 0 || p.X > domain.X/2 || p.Y < 0 || p.Y > domain.Y {
+			t.Fatalf("particle at (%v, %v) outside the masked left half", p.X, p.Y)
+		}
+		if p.Y < domain.Y/2 {
+			top++
+		} else {
+			bottom++
+		}
+	}
+	if top != bottom {
+		t.Errorf("uneven fill: %d particles in the top half, %d in the bottom", top, bottom)
+	}
+
+	if _, err := ImageMaskInitialCondition(path, domain, 201); err == nil {
+		t.Errorf("expected an error placing more particles than masked pixels")
+	}
+}
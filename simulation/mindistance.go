@@ -0,0 +1,97 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+)
+
+// goldenAngle spreads the separation directions of coincident pairs evenly
+// around the circle, so a stack of particles landing on one point fans out.
+const goldenAngle = 2.399963229728653
+
+// EnforceMinDistance pushes apart every pair of particles closer than
+// MinParticleDistance, each by half the shortfall, in one Jacobi pass after
+// integration. Only positions move: velocities are left alone, so the
+// constraint can't add energy the way a stiff repulsion force would, and it
+// keeps two particles that land on top of each other from producing the
+// density spike that blows a step up. Coincident pairs have no direction
+// between them, so one is picked from their indices. The grid is refreshed
+// first since integration has moved the particles, and pairs are measured
+// across periodic boundaries as FindNeighbors does. The grid's cells must be
+// at least MinParticleDistance across, which Validate ensures by bounding it
+// by InteractionRadius.
+//
+// Only the particles it pushes are moved, and they go through the same
+// boundary handling as in Integrate, positions only, so a push across a
+// periodic edge wraps and one into a wall stops at the wall.
+func (sim *FluidSim) EnforceMinDistance() {
+	d := sim.MinParticleDistance
+	if d <= 0 {
+		return
+	}
+	n := len(sim.Particles)
+	sim.Grid.Update(sim.Particles)
+	shift := make([]core.Vector, n)
+	sim.parallelRange(0, n, func(_, lo, hi int) {
+		var candidates []int
+		var shifts [][2]float64
+		for i := lo; i < hi; i++ {
+			p := &sim.Particles[i]
+			shifts = sim.periodicShifts(p.X, p.Y, d, shifts[:0])
+			for _, image := range shifts {
+				candidates = sim.Grid.GetNeighborParticles(p.X-image[0], p.Y-image[1], candidates[:0])
+				for _, j := range candidates {
+					if j == i {
+						continue
+					}
+					sim.minDistancePush(i, j, p.X-(sim.Particles[j].X+image[0]), p.Y-(sim.Particles[j].Y+image[1]), &shift[i])
+				}
+			}
+		}
+	})
+	sim.parallelFor(0, n, func(i int) {
+		if shift[i] == (core.Vector{}) {
+			return
+		}
+		p := &sim.Particles[i]
+		p.X += shift[i].X
+		p.Y += shift[i].Y
+		// the boundary handling also reflects velocities, which this leaves alone
+		vx, vy := p.Vx, p.Vy
+		spatial.HandleBoundaryWithRestitution(&p.X, &vx, sim.Domain.X, sim.LeftBoundary, sim.Restitution)
+		spatial.HandleBoundaryWithRestitution(&p.Y, &vy, sim.Domain.Y, sim.TopBoundary, sim.Restitution)
+		if sim.Domain.Shape == Circle {
+			sim.Domain.confineCircle(&p.X, &p.Y)
+		}
+	})
+}
+
+// minDistancePush adds to shift particle i's half of the push away from
+// particle j, which sits at (dx, dy) from it, when they are closer than
+// MinParticleDistance.
+func (sim *FluidSim) minDistancePush(i, j int, dx, dy float64, shift *core.Vector) {
+	d, n := sim.MinParticleDistance, len(sim.Particles)
+	dist := math.Hypot(dx, dy)
+	if dist >= d {
+		return
+	}
+	if dist == 0 {
+		// the lower index goes one way and the higher the other
+		first, second := i, j
+		if first > second {
+			first, second = second, first
+		}
+		angle := goldenAngle * float64(first*n+second)
+		dx, dy = math.Cos(angle), math.Sin(angle)
+		if i == first {
+			dx, dy = -dx, -dy
+		}
+		shift.X += 0.5 * d * dx
+		shift.Y += 0.5 * d * dy
+		return
+	}
+	push := 0.5 * (d - dist) / dist
+	shift.X += dx * push
+	shift.Y += dy * push
+}
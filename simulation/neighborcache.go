@@ -0,0 +1,101 @@
+package simulation
+
+import "fluids/spatial"
+
+// neighborCache holds, for each particle, every particle within the widened
+// search radius of it when the cache was built, along with where each
+// particle was then. Two particles each moved by at most half the skin since
+// then have closed in by at most the whole skin, so any pair within
+// InteractionRadius now was within InteractionRadius plus the skin when the
+// lists were built: checking the cached candidates misses no neighbor.
+type neighborCache struct {
+	candidates [][]neighborDistance
+	builtAt    []cachedPosition
+	radius     float64 // search radius the lists were built with, 0 when there are none
+	left, top  spatial.BoundaryType
+}
+
+// cachedPosition is where a particle was, and which particle sat at that
+// index, when the cache was built.
+type cachedPosition struct {
+	x, y float64
+	id   int
+}
+
+func (c *neighborCache) invalidate() {
+	c.radius = 0
+}
+
+// SetNeighborSkin sets NeighborSkin, resizing the grid's cells to the wider
+// search radius; see NeighborSkin.
+func (sim *FluidSim) SetNeighborSkin(skin float64) {
+	sim.NeighborSkin = skin
+	sim.Grid.Resize(sim.searchRadius())
+	sim.Grid.Update(sim.Particles)
+	sim.cache.invalidate()
+}
+
+// searchRadius is how far the grid is searched for neighbors: the
+// interaction radius plus the skin.
+func (sim *FluidSim) searchRadius() float64 {
+	return sim.InteractionRadius * (1 + sim.NeighborSkin)
+}
+
+// neighborCacheStale reports whether the cached candidate lists have to be
+// rebuilt: they were built for another radius, boundaries, or set of
+// particles, or some particle has moved more than half the skin since.
+// Particles wrapping around a periodic boundary jump a domain's width, so
+// they always trigger a rebuild.
+func (sim *FluidSim) neighborCacheStale() bool {
+	c := &sim.cache
+	if c.radius != sim.searchRadius() || len(c.builtAt) != len(sim.Particles) ||
+		c.left != sim.LeftBoundary || c.top != sim.TopBoundary {
+		return true
+	}
+	limit := 0.5 * sim.NeighborSkin * sim.InteractionRadius
+	for i := range sim.Particles {
+		p, at := &sim.Particles[i], c.builtAt[i]
+		dx, dy := p.X-at.x, p.Y-at.y
+		if p.ID != at.id || !(dx*dx+dy*dy <= limit*limit) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildNeighborCache finds every particle's candidates within the search
+// radius through the grid, which must be up to date.
+func (sim *FluidSim) buildNeighborCache() {
+	c := &sim.cache
+	n := len(sim.Particles)
+	if len(c.candidates) > n {
+		c.candidates = c.candidates[:n]
+	}
+	for len(c.candidates) < n {
+		c.candidates = append(c.candidates, nil)
+	}
+	c.builtAt = c.builtAt[:0]
+	radius := sim.searchRadius()
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		c.candidates[i] = sim.searchInRange(i, radius, c.candidates[i][:0])
+		c.builtAt = append(c.builtAt, cachedPosition{p.X, p.Y, p.ID})
+	}
+	c.radius = radius
+	c.left, c.top = sim.LeftBoundary, sim.TopBoundary
+}
+
+// cachedInRange appends the cached candidates of particle i that are within
+// InteractionRadius of it now, as searchInRange would find them.
+func (sim *FluidSim) cachedInRange(i int, dst []neighborDistance) []neighborDistance {
+	p := &sim.Particles[i]
+	h2 := sim.InteractionRadius * sim.InteractionRadius
+	for _, near := range sim.cache.candidates[i] {
+		dx := p.X - (sim.Particles[near.index].X + near.shiftX)
+		dy := p.Y - (sim.Particles[near.index].Y + near.shiftY)
+		if distanceSquared := dx*dx + dy*dy; distanceSquared < h2 {
+			dst = append(dst, neighborDistance{distanceSquared, near.index, near.shiftX, near.shiftY})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,70 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestNeighborSkinMatchesSearchingEveryStep(t *testing.T) {
+	newSim := func(skin float64) *FluidSim {
+		rand.Seed(5)
+		sim := NewFluidSim(80, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+		sim.LeftBoundary = spatial.Periodic
+		sim.SortNeighbors = true
+		sim.SetNeighborSkin(skin)
+		for i := range sim.Particles {
+			sim.Particles[i].Vx = float64(i%9) - 4
+		}
+		return sim
+	}
+	plain, cached := newSim(0), newSim(0.25)
+	for step := 0; step < 40; step++ {
+		plain.Advance(-100000, 10000, 0.0005)
+		cached.Advance(-100000, 10000, 0.0005)
+	}
+	for i := range plain.Particles {
+		a, b := plain.Particles[i], cached.Particles[i]
+		if a.X != b.X || a.Y != b.Y || a.Vx != b.Vx || a.Vy != b.Vy {
+			t.Fatalf("particle %d differs: (%g, %g) searching every step, (%g, %g) with a skin", i, a.X, a.Y, b.X, b.Y)
+		}
+	}
+}
+
+func TestNeighborSkinReusesSearchWhileStill(t *testing.T) {
+	sim := newLatticeSim(8, 1.0, spatial.SMOOTHING_RADIUS)
+	sim.SetNeighborSkin(0.25)
+	sim.Advance(0, 0, 0.0005)
+	built := sim.cache.builtAt[5]
+
+	for step := 0; step < 5; step++ {
+		sim.Advance(0, 0, 0.0005)
+	}
+	if sim.cache.builtAt[5] != built {
+		t.Errorf("neighbor cache rebuilt while nothing moved")
+	}
+
+	// moving one particle past half the skin forces a rebuild
+	sim.Particles[5].X += 0.6 * sim.NeighborSkin * sim.InteractionRadius
+	sim.Advance(0, 0, 0.0005)
+	if sim.cache.builtAt[5] == built {
+		t.Errorf("neighbor cache reused after a particle moved past half the skin")
+	}
+}
+
+func BenchmarkFindNeighborsStill(b *testing.B) {
+	for _, skin := range []float64{0, 0.1, 0.25} {
+		b.Run(fmt.Sprintf("skin=%g", skin), func(b *testing.B) {
+			sim := newLatticeSim(40, 1.0, spatial.SMOOTHING_RADIUS)
+			sim.SetNeighborSkin(skin)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if skin == 0 || sim.neighborCacheStale() {
+					sim.Grid.Update(sim.Particles)
+				}
+				sim.FindNeighbors()
+			}
+		})
+	}
+}
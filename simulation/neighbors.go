@@ -0,0 +1,132 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"sort"
+)
+
+// neighborDistance is a particle within range and its squared distance.
+// Across a periodic boundary the neighbor is seen at an image of its
+// position, offset by (shiftX, shiftY).
+type neighborDistance struct {
+	distanceSquared float64
+	index           int
+	shiftX, shiftY  float64
+}
+
+// periodicShifts appends the offsets at which other particles can appear
+// within radius h of (x, y): none for the particle's own copy of the domain,
+// plus one per periodic edge (and corner) it is close to.
+func (sim *FluidSim) periodicShifts(x, y, h float64, dst [][2]float64) [][2]float64 {
+	dst = append(dst, [2]float64{0, 0})
+	var shiftsX, shiftsY []float64
+	if sim.LeftBoundary == spatial.Periodic {
+		if x < h {
+			shiftsX = append(shiftsX, -sim.Domain.X)
+		}
+		if x > sim.Domain.X-h {
+			shiftsX = append(shiftsX, sim.Domain.X)
+		}
+	}
+	if sim.TopBoundary == spatial.Periodic {
+		if y < h {
+			shiftsY = append(shiftsY, -sim.Domain.Y)
+		}
+		if y > sim.Domain.Y-h {
+			shiftsY = append(shiftsY, sim.Domain.Y)
+		}
+	}
+	for _, sx := range shiftsX {
+		dst = append(dst, [2]float64{sx, 0})
+		for _, sy := range shiftsY {
+			dst = append(dst, [2]float64{sx, sy})
+		}
+	}
+	for _, sy := range shiftsY {
+		dst = append(dst, [2]float64{0, sy})
+	}
+	return dst
+}
+
+// selectNearest reorders near so its first k entries are the k closest, in
+// no particular order, by quickselect. It runs in expected linear time,
+// cheaper than a sort when a clump has far more neighbors than are kept.
+func selectNearest(near []neighborDistance, k int) {
+	lo, hi := 0, len(near)-1
+	for lo < hi {
+		pivot := near[(lo+hi)/2].distanceSquared
+		i, j := lo, hi
+		for i <= j {
+			for near[i].distanceSquared < pivot {
+				i++
+			}
+			for near[j].distanceSquared > pivot {
+				j--
+			}
+			if i <= j {
+				near[i], near[j] = near[j], near[i]
+				i++
+				j--
+			}
+		}
+		// now near[lo..j] <= pivot <= near[i..hi]
+		switch {
+		case k-1 <= j:
+			hi = j
+		case k-1 >= i:
+			lo = i
+		default:
+			return
+		}
+	}
+}
+
+// sortByIndex orders near by particle index, then by periodic image, with an
+// insertion sort: the lists are short, and the grid hands them over as a few
+// already-ascending runs, one per cell, so it does little work and allocates
+// nothing.
+func sortByIndex(near []neighborDistance) {
+	for i := 1; i < len(near); i++ {
+		cur := near[i]
+		j := i
+		for j > 0 && neighborBefore(cur, near[j-1]) {
+			near[j] = near[j-1]
+			j--
+		}
+		near[j] = cur
+	}
+}
+
+func neighborBefore(a, b neighborDistance) bool {
+	if a.index != b.index {
+		return a.index < b.index
+	}
+	if a.shiftX != b.shiftX {
+		return a.shiftX < b.shiftX
+	}
+	return a.shiftY < b.shiftY
+}
+
+// ClosestNeighbors appends to dst the positions of the k entries of p's
+// neighbor list nearest to it, closest first, leaving out p itself; k <= 0
+// keeps them all. The positions are those copied into the list when it was
+// built, including the shifted images of neighbors across a periodic edge.
+func ClosestNeighbors(p *core.Particle, k int, dst []core.Vector) []core.Vector {
+	start := len(dst)
+	for _, n := range p.Neighbors {
+		if n.ID != p.ID {
+			dst = append(dst, core.Vector{X: n.X, Y: n.Y})
+		}
+	}
+	near := dst[start:]
+	distance := func(v core.Vector) float64 {
+		dx, dy := v.X-p.X, v.Y-p.Y
+		return dx*dx + dy*dy
+	}
+	sort.Slice(near, func(a, b int) bool { return distance(near[a]) < distance(near[b]) })
+	if k > 0 && len(near) > k {
+		dst = dst[:start+k]
+	}
+	return dst
+}
@@ -0,0 +1,122 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSelectNearest(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for trial := 0; trial < 200; trial++ {
+		n := 1 + rng.Intn(60)
+		near := make([]neighborDistance, n)
+		for i := range near {
+			// few distinct values so ties are common
+			near[i] = neighborDistance{distanceSquared: float64(rng.Intn(10)), index: i}
+		}
+		sorted := append([]neighborDistance(nil), near...)
+		sort.Slice(sorted, func(a, b int) bool { return sorted[a].distanceSquared < sorted[b].distanceSquared })
+
+		k := 1 + rng.Intn(n)
+		selectNearest(near, k)
+		kept := 0.0
+		for _, nd := range near[:k] {
+			if nd.distanceSquared > sorted[k-1].distanceSquared {
+				t.Fatalf("n=%d k=%d: kept distance %v beyond the k-th smallest %v", n, k, nd.distanceSquared, sorted[k-1].distanceSquared)
+			}
+			kept += nd.distanceSquared
+		}
+		want := 0.0
+		for _, nd := range sorted[:k] {
+			want += nd.distanceSquared
+		}
+		if kept != want {
+			t.Fatalf("n=%d k=%d: kept distances sum to %v, want %v", n, k, kept, want)
+		}
+	}
+}
+
+func TestMaxNeighborsKeepsNearest(t *testing.T) {
+	const side = 15
+	sim := newLatticeSim(side, 1.0, spatial.SMOOTHING_RADIUS)
+	sim.MaxNeighbors = 9
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+
+	// an interior site's 9 nearest are itself and its 8 surrounding sites
+	center := sim.Particles[(side/2)*side+side/2]
+	if len(center.Neighbors) != 9 {
+		t.Fatalf("center kept %d neighbors, want 9", len(center.Neighbors))
+	}
+	for _, neighbor := range center.Neighbors {
+		if d := math.Hypot(neighbor.X-center.X, neighbor.Y-center.Y); d > math.Sqrt2+1e-9 {
+			t.Errorf("kept a neighbor at distance %v, beyond the nearest ring", d)
+		}
+	}
+	if sim.PeakNeighbors <= 9 {
+		t.Errorf("PeakNeighbors = %d, want the uncapped count", sim.PeakNeighbors)
+	}
+}
+
+func TestSortedNeighborsMakeGridTypesAgree(t *testing.T) {
+	newSim := func(gridType spatial.GridType) *FluidSim {
+		rand.Seed(11)
+		sim := NewFluidSim(120, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+		sim.SetGridType(gridType)
+		sim.SortNeighbors = true
+		sim.MaxNeighbors = 12
+		return sim
+	}
+	mapped, hashed := newSim(spatial.MapGrid), newSim(spatial.HashGridType)
+	for step := 0; step < 10; step++ {
+		mapped.Advance(-1000, 10000, 0.0005)
+		hashed.Advance(-1000, 10000, 0.0005)
+	}
+	for i := range mapped.Particles {
+		a, b := mapped.Particles[i], hashed.Particles[i]
+		if a.X != b.X || a.Y != b.Y || a.Vx != b.Vx || a.Vy != b.Vy {
+			t.Fatalf("particle %d differs between grid types: (%v, %v) and (%v, %v)", i, a.X, a.Y, b.X, b.Y)
+		}
+		for k := 1; k < len(a.Neighbors); k++ {
+			if a.Neighbors[k].ID < a.Neighbors[k-1].ID {
+				t.Fatalf("particle %d's neighbors are not in index order", i)
+			}
+		}
+	}
+}
+
+func TestSortByIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	near := make([]neighborDistance, 50)
+	for i := range near {
+		near[i] = neighborDistance{index: rng.Intn(20), shiftX: float64(rng.Intn(3) - 1)}
+	}
+	sortByIndex(near)
+	for i := 1; i < len(near); i++ {
+		if neighborBefore(near[i], near[i-1]) {
+			t.Fatalf("entry %d (%+v) sorts before entry %d (%+v)", i, near[i], i-1, near[i-1])
+		}
+	}
+}
+
+func TestClosestNeighbors(t *testing.T) {
+	p := core.Particle{ID: 0, X: 10, Y: 10}
+	p.Neighbors = []core.Particle{
+		{ID: 1, X: 13, Y: 10},
+		{ID: 0, X: 10, Y: 10},
+		{ID: 2, X: 10, Y: 11},
+		{ID: 3, X: 8, Y: 8},
+	}
+
+	got := ClosestNeighbors(&p, 2, nil)
+	if len(got) != 2 || got[0] != (core.Vector{X: 10, Y: 11}) || got[1] != (core.Vector{X: 8, Y: 8}) {
+		t.Errorf("two closest = %v, want (10, 11) then (8, 8)", got)
+	}
+	if all := ClosestNeighbors(&p, 0, nil); len(all) != 3 || all[2] != (core.Vector{X: 13, Y: 10}) {
+		t.Errorf("all neighbors = %v, want three ending with (13, 10)", all)
+	}
+}
@@ -2,30 +2,149 @@ package simulation
 
 import "sync"
 
+// ParallelConfig controls how parallel loops split work. Each FluidSim has
+// its own in its Parallel field; the package default is what NewFluidSim
+// starts a sim with and what code outside any sim uses.
+type ParallelConfig struct {
+	NumWorkers       int // maximum goroutines per parallel loop
+	MinimumBatchSize int // fewest indices worth handing to a worker; smaller loops run serially
+}
+
+var defaultParallelConfig = ParallelConfig{
+	NumWorkers:       4,
+	MinimumBatchSize: 32,
+}
+
+// SetParallelConfig replaces the package default. Sims already created keep
+// their own Parallel config.
+func SetParallelConfig(config ParallelConfig) {
+	defaultParallelConfig = config.normalized()
+}
+
+// DefaultParallelConfig returns the package default.
+func DefaultParallelConfig() ParallelConfig {
+	return defaultParallelConfig
+}
+
+func (config ParallelConfig) normalized() ParallelConfig {
+	if config.NumWorkers < 1 {
+		config.NumWorkers = 1
+	}
+	if config.MinimumBatchSize < 1 {
+		config.MinimumBatchSize = 1
+	}
+	return config
+}
+
+// parallel returns the sim's own config, or the package default for a sim
+// whose Parallel was never set, such as a FluidSim literal.
+func (sim *FluidSim) parallel() ParallelConfig {
+	if sim.Parallel == (ParallelConfig{}) {
+		return defaultParallelConfig
+	}
+	return sim.Parallel.normalized()
+}
+
+func (sim *FluidSim) parallelFor(start, end int, f func(int)) {
+	sim.parallel().parallelFor(start, end, f)
+}
+
+func (sim *FluidSim) parallelRange(start, end int, f func(worker, lo, hi int)) {
+	sim.parallel().parallelRange(start, end, f)
+}
+
+func (sim *FluidSim) parallelReduce(start, end int, identity float64, mapFn func(i int) float64, reduceFn func(a, b float64) float64) float64 {
+	return sim.parallel().parallelReduce(start, end, identity, mapFn, reduceFn)
+}
+
+// workerCount returns how many workers a loop over n indices should use.
+func (config ParallelConfig) workerCount(n int) int {
+	workers := n / config.MinimumBatchSize
+	if workers > config.NumWorkers {
+		workers = config.NumWorkers
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// parallelFor, parallelRange, and parallelReduce without a receiver use the
+// package default.
 func parallelFor(start, end int, f func(int)) {
-	tasks := make(chan int, end-start)
-	var wg sync.WaitGroup
+	defaultParallelConfig.parallelFor(start, end, f)
+}
 
-	// Number of workers, could be configurable
-	numWorkers := 4
+func parallelRange(start, end int, f func(worker, lo, hi int)) {
+	defaultParallelConfig.parallelRange(start, end, f)
+}
+
+func parallelReduce(start, end int, identity float64, mapFn func(i int) float64, reduceFn func(a, b float64) float64) float64 {
+	return defaultParallelConfig.parallelReduce(start, end, identity, mapFn, reduceFn)
+}
+
+func (config ParallelConfig) parallelFor(start, end int, f func(int)) {
+	config.parallelRange(start, end, func(_, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			f(i)
+		}
+	})
+}
 
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
+// parallelRange splits [start, end) into one contiguous chunk per worker and
+// calls f(worker, lo, hi) for each. Workers can keep private partial results
+// indexed by worker and combine them afterwards without locking. Ranges too
+// small to be worth splitting run on the calling goroutine as worker 0.
+func (config ParallelConfig) parallelRange(start, end int, f func(worker, lo, hi int)) {
+	n := end - start
+	if n <= 0 {
+		return
+	}
+	workers := config.workerCount(n)
+	if workers == 1 {
+		f(0, start, end)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo := start + n*w/workers
+		hi := start + n*(w+1)/workers
 		wg.Add(1)
-		go func() {
+		go func(w, lo, hi int) {
 			defer wg.Done()
-			for i := range tasks {
-				f(i)
-			}
-		}()
+			f(w, lo, hi)
+		}(w, lo, hi)
+	}
+	wg.Wait()
+}
+
+// parallelReduce folds mapFn(i) over [start, end) with reduceFn. Each worker
+// reduces its own chunk starting from identity and the partial results are
+// combined in worker order, so the result depends only on the parallel
+// configuration, not on scheduling. reduceFn must be associative and identity
+// its neutral element; nothing is allocated per index.
+func (config ParallelConfig) parallelReduce(start, end int, identity float64, mapFn func(i int) float64, reduceFn func(a, b float64) float64) float64 {
+	n := end - start
+	if n <= 0 {
+		return identity
 	}
+	partial := make([]float64, config.workerCount(n))
+	config.parallelRange(start, end, func(w, lo, hi int) {
+		acc := identity
+		for i := lo; i < hi; i++ {
+			acc = reduceFn(acc, mapFn(i))
+		}
+		partial[w] = acc
+	})
 
-	// Feed tasks
-	for i := start; i < end; i++ {
-		tasks <- i
+	result := identity
+	for _, acc := range partial {
+		result = reduceFn(result, acc)
 	}
+	return result
+}
 
-	// Close channel and wait for workers
-	close(tasks)
-	wg.Wait()
+func sum(a, b float64) float64 {
+	return a + b
 }
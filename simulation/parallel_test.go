@@ -0,0 +1,164 @@
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallelForVisitsEveryIndexOnce(t *testing.T) {
+	saved := defaultParallelConfig
+	defer SetParallelConfig(saved)
+
+	sizes := []int{0, 1, 2, 3, 7, 13, 31, 32, 33, 63, 64, 65, 97, 127, 128, 129, 1009, 4099}
+	for _, workers := range []int{1, 2, 3, 4, 7, 16} {
+		for _, batch := range []int{1, 32} {
+			SetParallelConfig(ParallelConfig{NumWorkers: workers, MinimumBatchSize: batch})
+			for _, n := range sizes {
+				// offset start so chunk math isn't only exercised from zero
+				const start = 5
+				counts := make([]int32, n)
+				parallelFor(start, start+n, func(i int) {
+					atomic.AddInt32(&counts[i-start], 1)
+				})
+				for i, c := range counts {
+					if c != 1 {
+						t.Fatalf("workers=%d batch=%d n=%d: index %d visited %d times", workers, batch, n, i, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParallelReduce(t *testing.T) {
+	saved := defaultParallelConfig
+	defer SetParallelConfig(saved)
+
+	for _, workers := range []int{1, 3, 4, 8} {
+		SetParallelConfig(ParallelConfig{NumWorkers: workers, MinimumBatchSize: 8})
+		for _, n := range []int{0, 1, 9, 100, 1001} {
+			got := parallelReduce(0, n, 0, func(i int) float64 { return float64(i) }, sum)
+			if want := float64(n*(n-1)) / 2; got != want {
+				t.Errorf("workers=%d n=%d: sum = %v, want %v", workers, n, got, want)
+			}
+			max := parallelReduce(0, n, -1, func(i int) float64 { return float64((i * 7919) % 1009) }, func(a, b float64) float64 {
+				if a > b {
+					return a
+				}
+				return b
+			})
+			want := -1.0
+			for i := 0; i < n; i++ {
+				if v := float64((i * 7919) % 1009); v > want {
+					want = v
+				}
+			}
+			if max != want {
+				t.Errorf("workers=%d n=%d: max = %v, want %v", workers, n, max, want)
+			}
+		}
+	}
+
+	// repeated runs under one config produce bit-identical results
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = 1 / float64(i+1)
+	}
+	first := parallelReduce(0, len(values), 0, func(i int) float64 { return values[i] }, sum)
+	for run := 0; run < 20; run++ {
+		if got := parallelReduce(0, len(values), 0, func(i int) float64 { return values[i] }, sum); got != first {
+			t.Fatalf("run %d: %v differs from first run %v", run, got, first)
+		}
+	}
+}
+
+// benchmarkUpdateDensities runs the density pass, the heaviest parallelFor
+// loop in a step, over a populated sim under the given parallel config.
+func benchmarkUpdateDensities(b *testing.B, n int, config ParallelConfig) {
+	sim := NewFluidSim(n, Domain{X: 100, Y: 100}, 0.0005, 1.0, 1.0)
+	sim.Parallel = config
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sim.UpdateDensities()
+	}
+}
+
+func BenchmarkUpdateDensities(b *testing.B) {
+	for _, n := range []int{100, 500, 2000, 10000} {
+		b.Run(fmt.Sprintf("serial/n=%d", n), func(b *testing.B) {
+			benchmarkUpdateDensities(b, n, ParallelConfig{NumWorkers: 4, MinimumBatchSize: 1 << 30})
+		})
+		b.Run(fmt.Sprintf("parallel/n=%d", n), func(b *testing.B) {
+			benchmarkUpdateDensities(b, n, defaultParallelConfig)
+		})
+	}
+}
+
+func TestSimsKeepTheirOwnParallelConfig(t *testing.T) {
+	saved := defaultParallelConfig
+	defer SetParallelConfig(saved)
+
+	SetParallelConfig(ParallelConfig{NumWorkers: 3, MinimumBatchSize: 16})
+	sim := NewFluidSim(10, Domain{X: 10, Y: 10}, 0.0005, 1, 1)
+	SetParallelConfig(ParallelConfig{NumWorkers: 7, MinimumBatchSize: 1})
+
+	if want := (ParallelConfig{NumWorkers: 3, MinimumBatchSize: 16}); sim.parallel() != want {
+		t.Errorf("sim uses %+v after the default changed, want the %+v it was created with", sim.parallel(), want)
+	}
+	if literal := (&FluidSim{}); literal.parallel() != defaultParallelConfig {
+		t.Errorf("sim without a config uses %+v, want the package default %+v", literal.parallel(), defaultParallelConfig)
+	}
+}
+
+func TestConcurrentSimsWithDifferentConfigs(t *testing.T) {
+	configs := []ParallelConfig{
+		{NumWorkers: 1, MinimumBatchSize: 1},
+		{NumWorkers: 3, MinimumBatchSize: 4},
+		{NumWorkers: 8, MinimumBatchSize: 1},
+	}
+	newSim := func(config ParallelConfig) *FluidSim {
+		rand.Seed(9)
+		sim := NewFluidSim(120, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+		sim.Parallel = config
+		return sim
+	}
+
+	// each config run alone, then all of them at once
+	alone := make([]*FluidSim, len(configs))
+	for k, config := range configs {
+		alone[k] = newSim(config)
+		for s := 0; s < 5; s++ {
+			alone[k].Advance(-1000, 10000, 0.0005)
+		}
+	}
+	together := make([]*FluidSim, len(configs))
+	for k, config := range configs {
+		together[k] = newSim(config)
+	}
+	var wg sync.WaitGroup
+	for _, sim := range together {
+		wg.Add(1)
+		go func(sim *FluidSim) {
+			defer wg.Done()
+			for s := 0; s < 5; s++ {
+				sim.Advance(-1000, 10000, 0.0005)
+			}
+		}(sim)
+	}
+	wg.Wait()
+
+	for k := range configs {
+		if together[k].Parallel != configs[k] {
+			t.Errorf("sim %d ended with config %+v, want %+v", k, together[k].Parallel, configs[k])
+		}
+		if pos, vel := Compare(alone[k], together[k]); pos != 0 || vel != 0 {
+			t.Errorf("sim %d with %+v diverged when run alongside the others: pos %v, vel %v", k, configs[k], pos, vel)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"fmt"
+	"math"
+)
+
+// SimParameters collects the tunable settings of a simulation run, both the
+// physical constants of the fluid and the interactive controls in main.
+type SimParameters struct {
+	Dt                 float64
+	Rho0               float64
+	Nu                 float64
+	PressureMultiplier float64
+	Gravity            float64
+	MouseForce         float64
+	InteractionRadius  float64
+	DensityRadius      float64 // density kernel support, at most InteractionRadius; 0 for the same
+	SettleSteps        int     // steps run without gravity and with heavy drag before interaction starts
+	RelaxIterations    int     // RelaxPacking iterations applied to the initial placement
+	InitialJitter      float64 // random offset of lattice initial conditions, in lattice spacings
+	RadiusBase         float64
+	RadiusVariation    float64 // 0 for identical particles
+	Restitution        float64 // fraction of normal velocity kept on a wall bounce
+	MaxSpeed           float64 // particle speed limit, 0 for unlimited
+	Adhesion           float64 // wall attraction, negative to repel
+	Friction           float64 // fraction of sliding velocity touching particles lose per step, 0 for none
+	EscapeThreshold    float64 // fraction of particles outside the domain that counts as the fluid escaping
+	AutoRecenter       bool    // pull escaped fluid back into the domain
+
+	MinParticleDistance float64 // pairs closer than this are pushed apart after each step, 0 to disable
+
+	RestPressureThreshold float64 // relative density excess below which pressure is softened, 0 to disable
+	CorrectPressureForce  bool    // standard mass-weighted SPH pressure force instead of the simplified one
+	CorrectViscosityForce bool    // standard SPH viscosity force, which scales with Nu, instead of the simplified one
+	NoDensityRepulsion    bool    // drop the push away from lower density neighbors
+
+	DivergenceFree       bool
+	DivergenceIterations int
+
+	NeighborCapacityHint int     // initial capacity of each particle's neighbor list
+	MaxNeighbors         int     // nearest neighbors kept per particle, 0 for all
+	NeighborSkin         float64 // neighbor search margin as a fraction of InteractionRadius, reused across steps; 0 to search every step
+
+	Material         MaterialModel // Fluid, or Granular for sand-like grains
+	GranularFriction float64       // friction coefficient between grains in Granular mode
+}
+
+func GetDefaultSimParameters() SimParameters {
+	return SimParameters{
+		Dt:                 0.0005,
+		Rho0:               1.0,
+		Nu:                 1.0,
+		PressureMultiplier: 10000.0,
+		Gravity:            0,
+		MouseForce:         100.0,
+		InteractionRadius:  spatial.SMOOTHING_RADIUS,
+		RadiusBase:         1.0,
+		RadiusVariation:    0,
+		Restitution:        spatial.DAMPENING_FACTOR,
+		EscapeThreshold:    DefaultEscapeThreshold,
+
+		DivergenceFree:       false,
+		DivergenceIterations: 3,
+
+		NeighborCapacityHint: defaultNeighborCapacity,
+
+		Material:         Fluid,
+		GranularFriction: defaultGranularFriction,
+	}
+}
+
+// Validate reports the first parameter that would make the simulation
+// produce garbage or NaNs, such as a non-positive time step or rest density.
+// The comparisons are written so NaN fails them too.
+func (p SimParameters) Validate() error {
+	positive := []struct {
+		name  string
+		value float64
+	}{
+		{"Dt", p.Dt},
+		{"Rho0", p.Rho0},
+		{"InteractionRadius", p.InteractionRadius},
+		{"RadiusBase", p.RadiusBase},
+	}
+	for _, f := range positive {
+		if !(f.value > 0) {
+			return fmt.Errorf("%s must be positive, got %g", f.name, f.value)
+		}
+	}
+	nonNegative := []struct {
+		name  string
+		value float64
+	}{
+		{"Nu", p.Nu},
+		{"PressureMultiplier", p.PressureMultiplier},
+		{"InitialJitter", p.InitialJitter},
+		{"MaxSpeed", p.MaxSpeed},
+		{"RestPressureThreshold", p.RestPressureThreshold},
+		{"SettleSteps", float64(p.SettleSteps)},
+		{"RelaxIterations", float64(p.RelaxIterations)},
+		{"DivergenceIterations", float64(p.DivergenceIterations)},
+		{"NeighborCapacityHint", float64(p.NeighborCapacityHint)},
+		{"MaxNeighbors", float64(p.MaxNeighbors)},
+		{"NeighborSkin", p.NeighborSkin},
+		{"GranularFriction", p.GranularFriction},
+		{"MinParticleDistance", p.MinParticleDistance},
+		{"DensityRadius", p.DensityRadius},
+	}
+	for _, f := range nonNegative {
+		if !(f.value >= 0) {
+			return fmt.Errorf("%s must not be negative, got %g", f.name, f.value)
+		}
+	}
+	if !(p.Restitution >= 0 && p.Restitution <= 1) {
+		return fmt.Errorf("Restitution must be between 0 and 1, got %g", p.Restitution)
+	}
+	// EnforceMinDistance finds close pairs through the grid, whose cells are
+	// an interaction radius across
+	if p.MinParticleDistance > p.InteractionRadius {
+		return fmt.Errorf("MinParticleDistance must not exceed InteractionRadius %g, got %g", p.InteractionRadius, p.MinParticleDistance)
+	}
+	if p.DensityRadius > p.InteractionRadius {
+		return fmt.Errorf("DensityRadius must not exceed InteractionRadius %g, got %g", p.InteractionRadius, p.DensityRadius)
+	}
+	if !(p.Friction >= 0 && p.Friction <= 1) {
+		return fmt.Errorf("Friction must be between 0 and 1, got %g", p.Friction)
+	}
+	if !(p.EscapeThreshold >= 0 && p.EscapeThreshold <= 1) {
+		return fmt.Errorf("EscapeThreshold must be between 0 and 1, got %g", p.EscapeThreshold)
+	}
+	// radii are spread over RadiusBase * (1 ± RadiusVariation/2)
+	if !(p.RadiusVariation >= 0 && p.RadiusVariation < 2) {
+		return fmt.Errorf("RadiusVariation must be at least 0 and below 2 so every radius stays positive, got %g", p.RadiusVariation)
+	}
+	if p.Material != Fluid && p.Material != Granular {
+		return fmt.Errorf("Material must be Fluid or Granular, got %d", p.Material)
+	}
+	if math.IsNaN(p.Gravity) || math.IsInf(p.Gravity, 0) || math.IsNaN(p.Adhesion) || math.IsInf(p.Adhesion, 0) {
+		return fmt.Errorf("Gravity and Adhesion must be finite, got %g and %g", p.Gravity, p.Adhesion)
+	}
+	return nil
+}
+
+// NewFluidSimWithParams is NewFluidSim for a set of parameters: it checks
+// them with Validate and returns a sim of n particles with them applied, or
+// the error naming the first bad one.
+func NewFluidSimWithParams(n int, domain Domain, params SimParameters) (*FluidSim, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	sim := NewFluidSim(n, domain, params.Dt, params.Rho0, params.Nu)
+	sim.ApplyTunables(params)
+	return sim, nil
+}
+
+// ApplyTunables updates the fluid properties that can change mid-run without
+// touching particle positions or velocities. The grid is resized if the
+// interaction radius changed, neighbor lists are grown to a larger capacity
+// hint, and particle radii are redrawn if RadiusBase or RadiusVariation
+// changed.
+func (sim *FluidSim) ApplyTunables(params SimParameters) {
+	sim.Rho0 = params.Rho0
+	sim.Nu = params.Nu
+	sim.Restitution = params.Restitution
+	sim.MaxSpeed = params.MaxSpeed
+	sim.Adhesion = params.Adhesion
+	sim.Friction = params.Friction
+	sim.EscapeThreshold = params.EscapeThreshold
+	sim.AutoRecenter = params.AutoRecenter
+	sim.MinParticleDistance = params.MinParticleDistance
+	sim.DensityRadius = params.DensityRadius
+	sim.RestPressureThreshold = params.RestPressureThreshold
+	sim.CorrectPressureForce = params.CorrectPressureForce
+	sim.CorrectViscosityForce = params.CorrectViscosityForce
+	sim.NoDensityRepulsion = params.NoDensityRepulsion
+	sim.DivergenceFree = params.DivergenceFree
+	sim.DivergenceIterations = params.DivergenceIterations
+	sim.MaxNeighbors = params.MaxNeighbors
+	sim.Material = params.Material
+	sim.GranularFriction = params.GranularFriction
+	if params.NeighborCapacityHint > 0 {
+		sim.SetNeighborCapacityHint(params.NeighborCapacityHint)
+	}
+	if params.NeighborSkin != sim.NeighborSkin {
+		sim.SetNeighborSkin(params.NeighborSkin)
+	}
+	if params.InteractionRadius != sim.InteractionRadius {
+		sim.SetInteractionRadius(params.InteractionRadius)
+	}
+	if params.RadiusBase != sim.RadiusBase || params.RadiusVariation != sim.RadiusVariation {
+		sim.SetRadii(params.RadiusBase, params.RadiusVariation)
+	}
+}
@@ -0,0 +1,63 @@
+package simulation
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDefaultParametersAreValid(t *testing.T) {
+	if err := GetDefaultSimParameters().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateNamesTheBadParameter(t *testing.T) {
+	cases := []struct {
+		change func(*SimParameters)
+		want   string
+	}{
+		{func(p *SimParameters) { p.Dt = 0 }, "Dt must be positive"},
+		{func(p *SimParameters) { p.Rho0 = -1 }, "Rho0 must be positive"},
+		{func(p *SimParameters) { p.InteractionRadius = math.NaN() }, "InteractionRadius must be positive"},
+		{func(p *SimParameters) { p.RadiusBase = -2 }, "RadiusBase must be positive"},
+		{func(p *SimParameters) { p.Nu = -0.5 }, "Nu must not be negative"},
+		{func(p *SimParameters) { p.MaxNeighbors = -1 }, "MaxNeighbors must not be negative"},
+		{func(p *SimParameters) { p.Restitution = 1.5 }, "Restitution must be between 0 and 1"},
+		{func(p *SimParameters) { p.DensityRadius = p.InteractionRadius + 1 }, "DensityRadius must not exceed InteractionRadius"},
+		{func(p *SimParameters) { p.MinParticleDistance = p.InteractionRadius + 1 }, "MinParticleDistance must not exceed InteractionRadius"},
+		{func(p *SimParameters) { p.Friction = 1.2 }, "Friction must be between 0 and 1"},
+		{func(p *SimParameters) { p.RadiusVariation = 2 }, "RadiusVariation must be at least 0 and below 2"},
+		{func(p *SimParameters) { p.Gravity = math.Inf(-1) }, "Gravity and Adhesion must be finite"},
+		{func(p *SimParameters) { p.GranularFriction = -0.1 }, "GranularFriction must not be negative"},
+		{func(p *SimParameters) { p.Material = 7 }, "Material must be Fluid or Granular"},
+	}
+	for _, c := range cases {
+		params := GetDefaultSimParameters()
+		c.change(&params)
+		err := params.Validate()
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("got error %v, want one containing %q", err, c.want)
+		}
+	}
+}
+
+func TestNewFluidSimWithParams(t *testing.T) {
+	params := GetDefaultSimParameters()
+	params.Nu, params.InteractionRadius, params.MaxNeighbors = 0.5, 6, 10
+	sim, err := NewFluidSimWithParams(20, Domain{X: 40, Y: 40}, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Particles) != 20 || sim.Dt != params.Dt {
+		t.Errorf("%d particles with Dt %v, want 20 with %v", len(sim.Particles), sim.Dt, params.Dt)
+	}
+	if got := sim.Tunables(params); got != params {
+		t.Errorf("sim holds %+v, want %+v", got, params)
+	}
+
+	params.Restitution = 2
+	if _, err := NewFluidSimWithParams(20, Domain{X: 40, Y: 40}, params); err == nil {
+		t.Errorf("Restitution 2 accepted")
+	}
+}
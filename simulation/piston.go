@@ -0,0 +1,33 @@
+package simulation
+
+import "fluids/spatial"
+
+// Piston is a horizontal plate spanning the domain at height Y, moving toward
+// larger Y (down the screen, the direction gravity pulls) at Velocity. Fluid
+// can't get above it, so driving it into the fluid compresses it.
+type Piston struct {
+	Y, Velocity float64
+}
+
+// applyPiston moves the plate by dt and pushes any particle above it back
+// below, at least as fast as the plate is moving. Once the plate reaches the
+// bottom of the domain it is lifted away, setting Piston to nil, rather than
+// pinning the fluid flat against the floor for good.
+func (sim *FluidSim) applyPiston(dt float64) {
+	piston := sim.Piston
+	piston.Y += piston.Velocity * dt
+	if piston.Y > sim.Domain.Y-spatial.EPSILON {
+		sim.Piston = nil
+		return
+	}
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		p := &sim.Particles[i]
+		if p.Y >= piston.Y {
+			return
+		}
+		p.Y = piston.Y
+		if p.Vy < piston.Velocity {
+			p.Vy = piston.Velocity
+		}
+	})
+}
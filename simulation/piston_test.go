@@ -0,0 +1,68 @@
+package simulation
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func meanDensity(sim *FluidSim) float64 {
+	total := 0.0
+	for _, p := range sim.Particles {
+		total += p.Density
+	}
+	return total / float64(len(sim.Particles))
+}
+
+func TestPistonCompressesFluid(t *testing.T) {
+	rand.Seed(1)
+	sim := NewFluidSim(200, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+	sim.Step(0, 10000, sim.Dt)
+	// measure density error relative to the uncompressed fluid
+	sim.Rho0 = meanDensity(sim)
+	before := sim.ComputeStepStats(0, 0, 0, 0)
+
+	// halve the fluid's height over 100 steps
+	sim.Piston = &Piston{Y: 0, Velocity: 300}
+	for step := 0; step < 100; step++ {
+		sim.Step(0, 10000, sim.Dt)
+	}
+	after := sim.ComputeStepStats(100, 0, 0, 0)
+
+	if sim.Piston.Y < 14 {
+		t.Fatalf("piston only reached Y=%v", sim.Piston.Y)
+	}
+	for i, p := range sim.Particles {
+		if p.Y < sim.Piston.Y {
+			t.Fatalf("particle %d at Y=%v is above the piston at %v", i, p.Y, sim.Piston.Y)
+		}
+	}
+	if density := meanDensity(sim); density < 1.5*sim.Rho0 {
+		t.Errorf("mean density %v after compression, want at least 1.5x the initial %v", density, sim.Rho0)
+	}
+	if after.DensityError < before.DensityError+0.5 {
+		t.Errorf("density error %v after compression, was %v", after.DensityError, before.DensityError)
+	}
+}
+
+func TestPistonLiftsAtTheFloor(t *testing.T) {
+	rand.Seed(1)
+	sim := NewFluidSim(100, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+	sim.Piston = &Piston{Velocity: 3000}
+	// the plate reaches the floor after 20 steps
+	for step := 0; step < 60; step++ {
+		sim.Step(0, 10000, sim.Dt)
+	}
+
+	if sim.Piston != nil {
+		t.Fatalf("piston still at Y=%v after bottoming out", sim.Piston.Y)
+	}
+	onFloor := 0
+	for _, p := range sim.Particles {
+		if p.Y > sim.Domain.Y-0.5 {
+			onFloor++
+		}
+	}
+	if onFloor > len(sim.Particles)/2 {
+		t.Errorf("%d of %d particles still crushed against the floor", onFloor, len(sim.Particles))
+	}
+}
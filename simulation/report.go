@@ -0,0 +1,123 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"fmt"
+	"io"
+	"math"
+)
+
+// RunReport compares the state at the start of a run with the state at the
+// end, as a check on what the run conserved.
+type RunReport struct {
+	Steps int
+
+	InitialParticles, FinalParticles         int
+	InitialMomentum, FinalMomentum           core.Vector // sum of m v
+	InitialKineticEnergy, FinalKineticEnergy float64     // sum of m v^2 / 2
+	// MomentumScale is the larger of the start and end sums of m |v|, the
+	// momentum the particles carry between them, which the drift in total
+	// momentum is measured against.
+	MomentumScale float64
+
+	MaxDensityError     float64 // mean |rho - rho0| / rho0, at its worst step
+	MaxDensityErrorStep int
+
+	// Closed is set when nothing outside the fluid acts on it: no gravity,
+	// periodic boundaries on every side, and no piston, wind tunnel, or
+	// speed clamp. Pressure and viscosity push particle pairs equally and
+	// oppositely, so total momentum should then stay where it started.
+	Closed bool
+}
+
+// NewRunReport records the starting state of a run under the given gravity.
+func NewRunReport(sim *FluidSim, gravity float64) *RunReport {
+	r := &RunReport{
+		InitialParticles:     len(sim.Particles),
+		InitialMomentum:      sim.Momentum(),
+		InitialKineticEnergy: sim.KineticEnergy(),
+		MaxDensityErrorStep:  -1,
+		Closed: gravity == 0 &&
+			sim.LeftBoundary == spatial.Periodic && sim.TopBoundary == spatial.Periodic &&
+			sim.Domain.Shape == Rect && sim.Piston == nil && sim.Tunnel == nil && sim.MaxSpeed == 0,
+	}
+	r.MomentumScale = momentumScale(sim.Particles)
+	r.finish(sim)
+	return r
+}
+
+// Record updates the report after a step.
+func (r *RunReport) Record(sim *FluidSim) {
+	if err := sim.densityError(); r.MaxDensityErrorStep < 0 || err > r.MaxDensityError {
+		r.MaxDensityError, r.MaxDensityErrorStep = err, r.Steps
+	}
+	r.Steps++
+	r.finish(sim)
+}
+
+func (r *RunReport) finish(sim *FluidSim) {
+	r.FinalParticles = len(sim.Particles)
+	r.FinalMomentum = sim.Momentum()
+	r.FinalKineticEnergy = sim.KineticEnergy()
+	r.MomentumScale = math.Max(r.MomentumScale, momentumScale(sim.Particles))
+}
+
+// MomentumDrift is how far total momentum moved over the run, relative to
+// MomentumScale, or absolute when nothing was moving.
+func (r *RunReport) MomentumDrift() float64 {
+	drift := math.Hypot(r.FinalMomentum.X-r.InitialMomentum.X, r.FinalMomentum.Y-r.InitialMomentum.Y)
+	if r.MomentumScale > 0 {
+		drift /= r.MomentumScale
+	}
+	return drift
+}
+
+// Write prints the report as a few lines of text.
+func (r *RunReport) Write(w io.Writer) error {
+	conserved := "not expected to be conserved: gravity, walls, or driving act on the fluid"
+	if r.Closed {
+		conserved = "closed system, should be near 0"
+	}
+	_, err := fmt.Fprintf(w, "run report over %d steps\n"+
+		"  particles       %d -> %d\n"+
+		"  momentum        (%.6g, %.6g) -> (%.6g, %.6g), drift %.3g (%s)\n"+
+		"  kinetic energy  %.6g -> %.6g\n"+
+		"  density error   worst %.4g at step %d\n",
+		r.Steps,
+		r.InitialParticles, r.FinalParticles,
+		r.InitialMomentum.X, r.InitialMomentum.Y, r.FinalMomentum.X, r.FinalMomentum.Y, r.MomentumDrift(), conserved,
+		r.InitialKineticEnergy, r.FinalKineticEnergy,
+		r.MaxDensityError, r.MaxDensityErrorStep)
+	return err
+}
+
+// Momentum is the total momentum of the particles, the sum of m v.
+func (sim *FluidSim) Momentum() core.Vector {
+	var total core.Vector
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		total.X += p.Mass * p.Vx
+		total.Y += p.Mass * p.Vy
+	}
+	return total
+}
+
+// KineticEnergy is the total kinetic energy of the particles, weighted by
+// mass, sum of m v^2 / 2.
+func (sim *FluidSim) KineticEnergy() float64 {
+	energy := 0.0
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		energy += 0.5 * p.Mass * (p.Vx*p.Vx + p.Vy*p.Vy)
+	}
+	return energy
+}
+
+func momentumScale(particles []core.Particle) float64 {
+	scale := 0.0
+	for i := range particles {
+		scale += particles[i].Mass * math.Hypot(particles[i].Vx, particles[i].Vy)
+	}
+	return scale
+}
@@ -0,0 +1,54 @@
+package simulation
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRunReportTracksAClosedRun(t *testing.T) {
+	sim := newTaylorGreenSim()
+	// a uniform drift on top of the vortex gives the fluid net momentum
+	for i := range sim.Particles {
+		sim.Particles[i].Vx += 3
+	}
+	report := NewRunReport(sim, 0)
+	if !report.Closed {
+		t.Fatalf("gravity-free periodic run not reported as closed")
+	}
+	if want := 3 * float64(len(sim.Particles)); math.Abs(report.InitialMomentum.X-want) > 1e-9 {
+		t.Errorf("initial momentum %v, want x = %v", report.InitialMomentum, want)
+	}
+	for s := 0; s < 20; s++ {
+		sim.Advance(0, 100, sim.Dt)
+		report.Record(sim)
+	}
+
+	if report.Steps != 20 || report.FinalParticles != len(sim.Particles) {
+		t.Errorf("report covers %d steps and %d particles, want 20 and %d", report.Steps, report.FinalParticles, len(sim.Particles))
+	}
+	if drift := report.MomentumDrift(); drift > 1e-6 {
+		t.Errorf("momentum drifted by %g of its scale in a closed run", drift)
+	}
+	if report.MaxDensityError < sim.densityError() {
+		t.Errorf("worst density error %v is below the final %v", report.MaxDensityError, sim.densityError())
+	}
+	var out bytes.Buffer
+	if err := report.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "closed system") {
+		t.Errorf("report doesn't say the run was closed:\n%s", out.String())
+	}
+}
+
+func TestRunReportUnderGravityIsNotClosed(t *testing.T) {
+	rand.Seed(1)
+	sim := NewFluidSim(50, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+	report := NewRunReport(sim, -1000)
+	if report.Closed {
+		t.Errorf("run under gravity in a walled box reported as closed")
+	}
+}
@@ -0,0 +1,55 @@
+package simulation
+
+// NearestParticle returns the index of the particle closest to (x, y) within
+// maxDistance, or -1 if there is none. Candidates come from the grid, so it
+// sees the positions of the last grid update, skipping particles removed
+// since, and maxDistance should not exceed a cell.
+func (sim *FluidSim) NearestParticle(x, y, maxDistance float64) int {
+	nearest := -1
+	best := maxDistance * maxDistance
+	for _, i := range sim.Grid.GetNeighborParticles(x, y, nil) {
+		if i >= len(sim.Particles) {
+			continue // removed since the grid was updated
+		}
+		p := &sim.Particles[i]
+		if d2 := (p.X-x)*(p.X-x) + (p.Y-y)*(p.Y-y); d2 <= best {
+			nearest, best = i, d2
+		}
+	}
+	return nearest
+}
+
+// IndexOfID returns the current index of the particle with the given ID, or
+// -1 if it has been removed.
+func (sim *FluidSim) IndexOfID(id int) int {
+	for i := range sim.Particles {
+		if sim.Particles[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// CellStats summarizes the grid cell containing (x, y): how many particles
+// it holds and their mean density and pressure, which are 0 for an empty
+// cell. The grid is current after every step, except under a NeighborSkin,
+// where it is only rebuilt when the neighbor cache goes stale; it is
+// rebuilt here first then.
+func (sim *FluidSim) CellStats(x, y float64) (count int, meanDensity, meanPressure float64) {
+	if sim.NeighborSkin > 0 {
+		sim.Grid.Update(sim.Particles)
+	}
+	for _, i := range sim.Grid.GetCellParticles(x, y, nil) {
+		if i >= len(sim.Particles) {
+			continue // removed since the grid was updated
+		}
+		count++
+		meanDensity += sim.Particles[i].Density
+		meanPressure += sim.Particles[i].Pressure
+	}
+	if count > 0 {
+		meanDensity /= float64(count)
+		meanPressure /= float64(count)
+	}
+	return count, meanDensity, meanPressure
+}
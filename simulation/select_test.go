@@ -0,0 +1,83 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestParticleIDsAreStable(t *testing.T) {
+	sim := NewFluidSim(10, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.RemoveParticles(3)
+	sim.AddParticles(5)
+
+	seen := map[int]bool{}
+	for i, p := range sim.Particles {
+		if seen[p.ID] {
+			t.Fatalf("ID %d reused", p.ID)
+		}
+		seen[p.ID] = true
+		if sim.IndexOfID(p.ID) != i {
+			t.Errorf("IndexOfID(%d) = %d, want %d", p.ID, sim.IndexOfID(p.ID), i)
+		}
+	}
+	// removed particles are gone for good
+	if sim.IndexOfID(8) != -1 {
+		t.Error("removed particle 8 still found")
+	}
+}
+
+func TestNearestParticle(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{{ID: 0, X: 10, Y: 10}, {ID: 1, X: 11, Y: 10}, {ID: 2, X: 30, Y: 30}}
+	sim.Grid.Update(sim.Particles)
+
+	if got := sim.NearestParticle(10.8, 10.1, 2); got != 1 {
+		t.Errorf("nearest to (10.8, 10.1) = %d, want 1", got)
+	}
+	if got := sim.NearestParticle(20, 20, 2); got != -1 {
+		t.Errorf("found particle %d with none in range", got)
+	}
+}
+
+func TestNearestParticleSkipsRemovedParticles(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{{ID: 0, X: 10, Y: 10}, {ID: 1, X: 11, Y: 10}}
+	sim.Grid.Update(sim.Particles)
+	// removed while paused, before a step updates the grid
+	sim.RemoveParticles(1)
+	if got := sim.NearestParticle(11, 10, 2); got != 0 {
+		t.Errorf("nearest to (11, 10) = %d, want 0, the only particle left", got)
+	}
+}
+
+func TestCellStats(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.Particles = []core.Particle{
+		{ID: 0, X: 1, Y: 1, Density: 2, Pressure: 10},
+		{ID: 1, X: 2, Y: 3, Density: 4, Pressure: 30},
+		{ID: 2, X: 30, Y: 30, Density: 9, Pressure: 90},
+	}
+	sim.Grid.Update(sim.Particles)
+
+	if n, rho, p := sim.CellStats(1.5, 1.5); n != 2 || rho != 3 || p != 20 {
+		t.Errorf("CellStats = %d, %g, %g, want 2, 3, 20", n, rho, p)
+	}
+	if n, rho, p := sim.CellStats(20, 10); n != 0 || rho != 0 || p != 0 {
+		t.Errorf("empty cell: CellStats = %d, %g, %g, want zeros", n, rho, p)
+	}
+}
+
+func TestCellStatsSeesMovesUnderANeighborSkin(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	sim.SetNeighborSkin(0.5)
+	sim.Particles = []core.Particle{{ID: 0, X: 1, Y: 1, Density: 2}}
+	sim.Grid.Update(sim.Particles)
+	// moved without a step, as a cached step leaves the grid behind
+	sim.Particles[0].X, sim.Particles[0].Y = 30, 30
+	if n, _, _ := sim.CellStats(30, 30); n != 1 {
+		t.Errorf("cell at the particle's new spot holds %d, want 1", n)
+	}
+	if n, _, _ := sim.CellStats(1, 1); n != 0 {
+		t.Errorf("cell it left holds %d, want 0", n)
+	}
+}
@@ -0,0 +1,33 @@
+package simulation
+
+import "math"
+
+// settledMaxFactor bounds the fastest particle of a settled fluid, as a
+// multiple of the mean speed threshold, so a few particles still skidding
+// across a resting pool keep it from counting as settled.
+const settledMaxFactor = 10
+
+// IsSettled reports whether the fluid has come to rest: its mean speed is
+// below speedThreshold and no particle is faster than settledMaxFactor times
+// that. A fluid only counts as settled after it has been seen moving, with a
+// mean speed at or above the threshold, at some earlier call; otherwise a blob
+// dropped from rest would be settled before it starts to fall. Call it once
+// per step.
+func (sim *FluidSim) IsSettled(speedThreshold float64) bool {
+	n := len(sim.Particles)
+	if n == 0 {
+		return false
+	}
+	speedSum, maxSpeed := 0.0, 0.0
+	for i := range sim.Particles {
+		speed := math.Hypot(sim.Particles[i].Vx, sim.Particles[i].Vy)
+		speedSum += speed
+		maxSpeed = math.Max(maxSpeed, speed)
+	}
+	meanSpeed := speedSum / float64(n)
+	if meanSpeed >= speedThreshold {
+		sim.hasMoved = true
+		return false
+	}
+	return sim.hasMoved && maxSpeed < settledMaxFactor*speedThreshold
+}
@@ -0,0 +1,38 @@
+package simulation
+
+import "testing"
+
+func setSpeeds(sim *FluidSim, speed float64) {
+	for i := range sim.Particles {
+		sim.Particles[i].Vx, sim.Particles[i].Vy = speed, 0
+	}
+}
+
+func TestIsSettledNeedsMotionFirst(t *testing.T) {
+	sim := NewFluidSim(50, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	setSpeeds(sim, 0)
+	if sim.IsSettled(1) {
+		t.Fatal("a fluid that has never moved counts as settled")
+	}
+	setSpeeds(sim, 5)
+	if sim.IsSettled(1) {
+		t.Fatal("a moving fluid counts as settled")
+	}
+	setSpeeds(sim, 0.5)
+	if !sim.IsSettled(1) {
+		t.Fatal("a fluid slowed below the threshold after moving is not settled")
+	}
+}
+
+func TestIsSettledRejectsFastStragglers(t *testing.T) {
+	sim := NewFluidSim(50, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	setSpeeds(sim, 5)
+	sim.IsSettled(1)
+
+	// one particle skidding at 20 leaves the mean at 0.4, under the threshold
+	setSpeeds(sim, 0)
+	sim.Particles[0].Vx = 20
+	if sim.IsSettled(1) {
+		t.Error("a pool with a particle moving at 20x the threshold counts as settled")
+	}
+}
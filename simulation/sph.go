@@ -3,62 +3,315 @@ package simulation
 import (
 	"fluids/core"
 	"fluids/spatial"
-	"fmt"
 	"math"
 	"math/rand"
-	"sync"
+	"sync/atomic"
 )
 
 type InitialConditionFunc func(i, n int) (x, y, vx, vy float64)
 
 type Domain struct {
-	X, Y float64
+	X, Y   float64
+	Shape  DomainShape
+	Radius float64 // Circle only
 }
 
 func RandomStillInitialCondition(i int, domain Domain) (float64, float64, float64, float64) {
-	x := rand.Float64() * domain.X
-	y := rand.Float64() * domain.Y
+	x, y := domain.randomPoint()
 	// vx := (rand.Float64() * 2.0) - 1.0
 	// vy := (rand.Float64() * 2.0) - 1.0
 	return x, y, 0, 0
 }
 
 func RandomMotionInitialCondition(i int, domain Domain) (float64, float64, float64, float64) {
-	x := rand.Float64() * domain.X
-	y := rand.Float64() * domain.Y
+	x, y := domain.randomPoint()
 	vx := (rand.Float64() * 2.0) - 1.0
 	vy := (rand.Float64() * 2.0) - 1.0
 	return x, y, vx, vy
 }
 
 type FluidSim struct {
-	Particles    []core.Particle
-	N            int     // Number of particles
-	Dt           float64 // Time step
-	Rho0, Nu     float64 // Reference density and viscosity
-	Domain       Domain  // Domain of the simulation
-	Grid         *spatial.Grid
-	LeftBoundary spatial.BoundaryType
-	TopBoundary  spatial.BoundaryType
+	Particles         []core.Particle
+	N                 int     // Number of particles
+	Dt                float64 // Time step
+	Rho0, Nu          float64 // Reference density and viscosity
+	InteractionRadius float64 // Kernel support radius, also the grid cell size widened by NeighborSkin
+	DensityRadius     float64 // Density kernel support, at most InteractionRadius; 0 uses InteractionRadius
+	Domain            Domain  // Domain of the simulation
+	Grid              spatial.NeighborGrid
+	GridType          spatial.GridType
+	LeftBoundary      spatial.BoundaryType
+	TopBoundary       spatial.BoundaryType
+	RadiusBase        float64     // Particle radius; a particle of this radius has unit mass
+	RadiusVariation   float64     // Radii are spread uniformly over RadiusBase * (1 ± RadiusVariation/2)
+	Restitution       float64     // Fraction of normal velocity kept on a wall bounce; 1 is elastic
+	Piston            *Piston     // Moving lid, nil for none
+	Tunnel            *WindTunnel // Inflow forcing and obstacle, nil for none
+	MaxSpeed          float64     // Speeds are clamped to this in Integrate; 0 for unlimited
+	Clamped           int         // Particles whose speed the last Integrate clamped
+	Iterations        int         // Pressure solver iterations the last Advance took
+	Adhesion          float64     // Attraction to the walls per unit density; negative repels, 0 for none
+	Friction          float64     // Fraction of sliding velocity touching particles lose each step, 0 to 1
+	EscapedFraction   float64     // Fraction of particles outside the domain after the last Advance
+	EscapeThreshold   float64     // Escaped fraction at which AutoRecenter steps in
+	AutoRecenter      bool        // Pull the fluid back into the domain once too much of it escapes
+
+	SplashSpeed float64  // Wall impacts faster than this are recorded in Splashes; 0 to disable
+	Splashes    []Splash // The hardest wall impacts of the last Integrate, at most MaxSplashesPerStep
+
+	// DoubleBuffer makes Integrate write into a shadow copy of Particles and
+	// swap it in, instead of updating particles in place
+	DoubleBuffer bool
+
+	// MinParticleDistance is the closest two particles may sit after a step;
+	// closer pairs are pushed apart. 0 disables it
+	MinParticleDistance float64
+
+	// RestPressureThreshold softens the pressure force on particles whose
+	// density is above Rho0 by less than this fraction; 0 disables it
+	RestPressureThreshold float64
+
+	// CorrectPressureForce uses the standard symmetric SPH pressure force,
+	// which weights each neighbor by its mass, instead of the simplified one.
+	// Like the divergence projection it finds neighbors through the grid, so
+	// it doesn't honor MaxNeighbors
+	CorrectPressureForce bool
+
+	// CorrectViscosityForce uses the standard SPH viscosity force, which
+	// scales with Nu, instead of the simplified one, which doesn't
+	CorrectViscosityForce bool
+
+	// NoDensityRepulsion drops the push away from lower density neighbors.
+	// It scales with the pressure multiplier and never balances, so a pool
+	// only comes to rest, with pressure rising linearly with depth, without it
+	NoDensityRepulsion bool
+
+	DivergenceFree       bool // Project velocities toward zero divergence each step
+	DivergenceIterations int  // Jacobi iterations of that projection
+
+	NeighborCapacityHint int // Initial capacity of each particle's neighbor list
+	PeakNeighbors        int // Largest neighbor count FindNeighbors has seen; tune the hint with it
+	MaxNeighbors         int // Keep only this many nearest neighbors per particle; 0 for all
+
+	// SortNeighbors orders every neighbor list by particle index. The grid
+	// hands neighbors over cell by cell, so without it the order, and with
+	// it the rounding of every force sum, depends on the grid type and cell
+	// layout; sorted, the same particles give bit-identical steps.
+	SortNeighbors bool
+
+	// NeighborSkin, as a fraction of InteractionRadius, widens the neighbor
+	// search so its results can be reused across steps: the grid and the
+	// candidate lists are only rebuilt once some particle has moved half
+	// the skin since the last rebuild, and each step just checks the cached
+	// candidates' distances. 0 rebuilds every step. Set it with
+	// SetNeighborSkin, which resizes the grid's cells to the wider search
+	NeighborSkin float64
+
+	Material          MaterialModel // Fluid, or Granular for sand-like grains
+	GranularStiffness float64       // Contact spring constant between grains
+	GranularDamping   float64       // Contact damping as a fraction of critical damping
+	GranularFriction  float64       // Coulomb friction coefficient between grains and against walls
+
+	// OnStep, if set, is called at the end of every Step and StepWith with
+	// the step's index, counting from 0, and the particles. The slice is the
+	// sim's own and only valid during the call: read it, don't modify or
+	// retain it, and copy out whatever is needed afterwards.
+	OnStep func(step int, particles []core.Particle)
+
+	// Parallel splits this sim's loops across workers; sims stepped side by
+	// side can each have their own. NewFluidSim starts from the package default.
+	Parallel ParallelConfig
+
+	candidates     []int              // grid query buffer reused across FindNeighbors calls
+	spareNeighbors [][]core.Particle  // each particle's previous neighbor list, refilled next step
+	shifts         [][2]float64       // periodic image offsets reused across FindNeighbors calls
+	nextID         int                // ID for the next particle added
+	inRange        []neighborDistance // neighbors in range before the MaxNeighbors cut
+	hasMoved       bool               // mean speed has reached an IsSettled threshold
+	steps          int                // index of the next Step or StepWith call, for OnStep
+	nextParticles  []core.Particle    // Integrate's shadow buffer when DoubleBuffer is set
+	impacts        []float64          // each particle's wall impact speed in the last Integrate
+	cache          neighborCache      // candidate lists reused across steps under a NeighborSkin
+	tiled          bool               // a tile of a TiledSim, which ages the particles itself
 }
 
+// defaultNeighborCapacity covers a moderately dense fluid at the default
+// smoothing radius without the neighbor lists having to grow.
+const defaultNeighborCapacity = 32
+
 func NewFluidSim(n int, domain Domain, dt, rho0, nu float64) *FluidSim {
-	particles := make([]core.Particle, n)
-	for i := 0; i < n; i++ {
-		particles[i].X, particles[i].Y, particles[i].Vx, particles[i].Vy = RandomStillInitialCondition(i, domain)
-		particles[i].Density = rho0
+	radius := spatial.SMOOTHING_RADIUS
+	grid := spatial.NewNeighborGrid(spatial.MapGrid, radius, int(domain.X), int(domain.Y))
+	sim := &FluidSim{
+		Particles:         make([]core.Particle, 0, n),
+		Dt:                dt,
+		Domain:            domain,
+		Rho0:              rho0,
+		Nu:                nu,
+		InteractionRadius: radius,
+		Grid:              grid,
+		RadiusBase:        1.0,
+		Restitution:       spatial.DAMPENING_FACTOR,
+
+		DivergenceIterations: 3,
+		NeighborCapacityHint: defaultNeighborCapacity,
+		Parallel:             defaultParallelConfig,
+		EscapeThreshold:      DefaultEscapeThreshold,
+		GranularStiffness:    defaultGranularStiffness,
+		GranularDamping:      defaultGranularDamping,
+		GranularFriction:     defaultGranularFriction,
 	}
+	sim.AddParticles(n)
+	return sim
+}
 
-	grid := spatial.NewGrid(spatial.SMOOTHING_RADIUS, int(domain.X), int(domain.Y))
-	return &FluidSim{
-		Particles: particles,
-		N:         n,
-		Dt:        dt,
-		Domain:    domain,
-		Rho0:      rho0,
-		Nu:        nu,
-		Grid:      grid,
+// SetNeighborCapacityHint sets the neighbor list capacity new particles start
+// with and grows any existing list that is smaller.
+func (sim *FluidSim) SetNeighborCapacityHint(hint int) {
+	sim.NeighborCapacityHint = hint
+	for i := range sim.Particles {
+		if p := &sim.Particles[i]; cap(p.Neighbors) < hint {
+			p.Neighbors = make([]core.Particle, 0, hint)
+		}
+	}
+}
+
+// SetRadii redraws every particle's radius from RadiusBase and RadiusVariation.
+// Mass scales with area, (radius / RadiusBase)^2, so zero variation gives
+// identical unit-mass particles.
+func (sim *FluidSim) SetRadii(base, variation float64) {
+	sim.RadiusBase, sim.RadiusVariation = base, variation
+	for i := range sim.Particles {
+		sim.assignRadius(&sim.Particles[i])
+	}
+}
+
+func (sim *FluidSim) assignRadius(p *core.Particle) {
+	scale := 1.0
+	if sim.RadiusVariation != 0 {
+		scale = 1 + sim.RadiusVariation*(rand.Float64()-0.5)
+	}
+	p.Radius = sim.RadiusBase * scale
+	p.Mass = scale * scale
+}
+
+// ApplyInitialCondition re-places every particle with the given initial condition.
+func (sim *FluidSim) ApplyInitialCondition(ic InitialConditionFunc) {
+	n := len(sim.Particles)
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		p.X, p.Y, p.Vx, p.Vy = ic(i, n)
+	}
+}
+
+// Freeze zeroes every particle's velocity, leaving the fluid to fall or
+// re-settle from rest.
+func (sim *FluidSim) Freeze() {
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		sim.Particles[i].Vx = 0
+		sim.Particles[i].Vy = 0
+	})
+}
+
+// AddParticles spawns count particles at random positions in the domain, the
+// same way NewFluidSim places them.
+func (sim *FluidSim) AddParticles(count int) {
+	for i := 0; i < count; i++ {
+		var p core.Particle
+		p.ID = sim.nextID
+		sim.nextID++
+		p.X, p.Y, p.Vx, p.Vy = RandomStillInitialCondition(len(sim.Particles), sim.Domain)
+		p.Density = sim.Rho0
+		p.R, p.G, p.B = 255, 255, 255
+		p.Neighbors = make([]core.Particle, 0, sim.NeighborCapacityHint)
+		sim.assignRadius(&p)
+		sim.Particles = append(sim.Particles, p)
+	}
+	sim.N = len(sim.Particles)
+}
+
+// AddBlock fills the rectangle with top-left corner (x, y), width w, and
+// height h with particles at rest on a square lattice of the given spacing,
+// and returns how many it added. Lattice sites outside the domain, or closer
+// than spacing to a particle already there, are skipped, so a block dropped
+// onto existing fluid fills in around it instead of piling on top of it.
+func (sim *FluidSim) AddBlock(x, y, w, h, spacing float64) int {
+	if !(spacing > 0) || !(w > 0) || !(h > 0) {
+		return 0
+	}
+	grid := spatial.NewNeighborGrid(sim.GridType, spacing, int(sim.Domain.X), int(sim.Domain.Y))
+	grid.Update(sim.Particles)
+	existing := len(sim.Particles)
+
+	var candidates []int
+	for row := 0; (float64(row)+0.5)*spacing < h; row++ {
+		for col := 0; (float64(col)+0.5)*spacing < w; col++ {
+			px := x + (float64(col)+0.5)*spacing
+			py := y + (float64(row)+0.5)*spacing
+			if !sim.Domain.Contains(px, py) {
+				continue
+			}
+			crowded := false
+			candidates = grid.GetNeighborParticles(px, py, candidates[:0])
+			for _, j := range candidates {
+				dx, dy := px-sim.Particles[j].X, py-sim.Particles[j].Y
+				if dx*dx+dy*dy < spacing*spacing {
+					crowded = true
+					break
+				}
+			}
+			if crowded {
+				continue
+			}
+
+			// sites of the block itself are spacing apart, so only the
+			// particles already there need checking
+			p := core.Particle{ID: sim.nextID, X: px, Y: py, Density: sim.Rho0}
+			sim.nextID++
+			p.R, p.G, p.B = 255, 255, 255
+			p.Neighbors = make([]core.Particle, 0, sim.NeighborCapacityHint)
+			sim.assignRadius(&p)
+			sim.Particles = append(sim.Particles, p)
+		}
 	}
+	sim.N = len(sim.Particles)
+	return sim.N - existing
+}
+
+// RemoveParticles drops up to count particles from the end of the slice.
+func (sim *FluidSim) RemoveParticles(count int) {
+	if count > len(sim.Particles) {
+		count = len(sim.Particles)
+	}
+	sim.Particles = sim.Particles[:len(sim.Particles)-count]
+	sim.N = len(sim.Particles)
+}
+
+// SetInteractionRadius changes the kernel support at runtime. The grid's
+// cells are resized to match, since a query only scans the 3x3 block of
+// cells around a point and would miss neighbors farther than one cell away,
+// and the index and neighbor lists are rebuilt so they're current even
+// before the next step.
+func (sim *FluidSim) SetInteractionRadius(radius float64) {
+	sim.InteractionRadius = radius
+	sim.Grid.Resize(sim.searchRadius())
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+}
+
+// SetGridType swaps the spatial index used for neighbor search.
+func (sim *FluidSim) SetGridType(gridType spatial.GridType) {
+	sim.GridType = gridType
+	sim.Grid = spatial.NewNeighborGrid(gridType, sim.searchRadius(), int(sim.Domain.X), int(sim.Domain.Y))
+	sim.cache.invalidate()
+}
+
+// RecordPositions saves each particle's current position as its previous one.
+func (sim *FluidSim) RecordPositions() {
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		p := &sim.Particles[i]
+		p.PrevX, p.PrevY = p.X, p.Y
+	})
 }
 
 func (sim *FluidSim) PredictPositions(dt float64) {
@@ -69,45 +322,125 @@ func (sim *FluidSim) PredictPositions(dt float64) {
 	}
 }
 
+// FindNeighbors collects every particle within InteractionRadius of each
+// particle, itself included, keeping only the MaxNeighbors nearest when that
+// is set, and in particle index order when SortNeighbors is set. Each list
+// is built into the buffer its previous list used two
+// steps ago and swapped in, so once the buffers have grown to the densest
+// configuration seen no further allocation happens. Swapping rather than
+// refilling in place matters: a neighbor copy taken before that neighbor's
+// own list is rebuilt holds its previous list, which must stay intact for
+// the rest of the step. With a NeighborSkin the particles within range are
+// picked out of the neighbor cache rather than found through the grid.
 func (sim *FluidSim) FindNeighbors() {
+	n := len(sim.Particles)
+	if len(sim.spareNeighbors) > n {
+		sim.spareNeighbors = sim.spareNeighbors[:n]
+	}
+	for len(sim.spareNeighbors) < n {
+		sim.spareNeighbors = append(sim.spareNeighbors, make([]core.Particle, 0, sim.NeighborCapacityHint))
+	}
+
+	cached := sim.NeighborSkin > 0
+	if cached && sim.neighborCacheStale() {
+		sim.buildNeighborCache()
+	}
 	for i := range sim.Particles {
-		sim.Particles[i].Neighbors = []core.Particle{}
-		cellX, cellY := int(sim.Particles[i].X/sim.Grid.CellSize), int(sim.Particles[i].Y/sim.Grid.CellSize)
-
-		for dx := -1; dx <= 1; dx++ {
-			for dy := -1; dy <= 1; dy++ {
-				neighborCellX, neighborCellY := cellX+dx, cellY+dy
-				key := fmt.Sprintf("%d-%d", neighborCellX, neighborCellY) // make cell key
-
-				if neighborIndices, found := sim.Grid.CellMap[key]; found {
-					for _, neighborIdx := range neighborIndices {
-						dx := sim.Particles[i].X - sim.Particles[neighborIdx].X
-						dy := sim.Particles[i].Y - sim.Particles[neighborIdx].Y
-						distanceSquared := dx*dx + dy*dy
-
-						if distanceSquared < spatial.SMOOTHING_RADIUS*spatial.SMOOTHING_RADIUS {
-							sim.Particles[i].Neighbors = append(sim.Particles[i].Neighbors, sim.Particles[neighborIdx])
-						}
-					}
-				}
+		neighbors := sim.spareNeighbors[i][:0]
+
+		var inRange []neighborDistance
+		if cached {
+			inRange = sim.cachedInRange(i, sim.inRange[:0])
+		} else {
+			inRange = sim.searchInRange(i, sim.InteractionRadius, sim.inRange[:0])
+		}
+		if count := len(inRange); count > sim.PeakNeighbors {
+			sim.PeakNeighbors = count
+		}
+		if sim.SortNeighbors {
+			sortByIndex(inRange)
+		}
+		if sim.MaxNeighbors > 0 && len(inRange) > sim.MaxNeighbors {
+			selectNearest(inRange, sim.MaxNeighbors)
+			inRange = inRange[:sim.MaxNeighbors]
+			if sim.SortNeighbors {
+				sortByIndex(inRange)
+			}
+		}
+		for _, near := range inRange {
+			neighbor := sim.Particles[near.index]
+			neighbor.X += near.shiftX
+			neighbor.Y += near.shiftY
+			neighbors = append(neighbors, neighbor)
+		}
+		sim.inRange = inRange
+		sim.spareNeighbors[i] = sim.Particles[i].Neighbors
+		sim.Particles[i].Neighbors = neighbors
+	}
+}
+
+// searchInRange appends every particle within radius h of particle i, found
+// through the grid, with its squared distance and periodic image offset.
+func (sim *FluidSim) searchInRange(i int, h float64, dst []neighborDistance) []neighborDistance {
+	p := &sim.Particles[i]
+	sim.shifts = sim.periodicShifts(p.X, p.Y, h, sim.shifts[:0])
+	for _, shift := range sim.shifts {
+		// a neighbor seen shifted by s sits near this particle's position minus s
+		sim.candidates = sim.Grid.GetNeighborParticles(p.X-shift[0], p.Y-shift[1], sim.candidates[:0])
+		for _, neighborIdx := range sim.candidates {
+			dx := p.X - (sim.Particles[neighborIdx].X + shift[0])
+			dy := p.Y - (sim.Particles[neighborIdx].Y + shift[1])
+			distanceSquared := dx*dx + dy*dy
+
+			if distanceSquared < h*h {
+				dst = append(dst, neighborDistance{distanceSquared, neighborIdx, shift[0], shift[1]})
 			}
 		}
 	}
+	return dst
 }
 
+// UpdateDensities sums each particle's density over its neighbors with the
+// kernel cut off at densityRadius. Searching neighbors over a larger
+// InteractionRadius than that gives the lists some slack: particles just
+// outside the density support are already in them when they move in.
 func (sim *FluidSim) UpdateDensities() {
-	parallelFor(0, len(sim.Particles), func(i int) {
-		sim.Particles[i].Density = spatial.CalculateDensity(sim.Particles[i])
+	radius := sim.densityRadius()
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		sim.Particles[i].Density = spatial.CalculateDensity(sim.Particles[i], radius)
 	})
 }
 
+// densityRadius is the support of the density kernel: DensityRadius when it
+// is set, capped at InteractionRadius since neighbors farther than that
+// aren't found.
+func (sim *FluidSim) densityRadius() float64 {
+	if sim.DensityRadius > 0 && sim.DensityRadius < sim.InteractionRadius {
+		return sim.DensityRadius
+	}
+	return sim.InteractionRadius
+}
+
 // update pressure based on density
 func (sim *FluidSim) UpdatePressure(pressureMultiplier float64) {
-	parallelFor(0, len(sim.Particles), func(i int) {
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
 		sim.Particles[i].Pressure = pressureMultiplier * (sim.Particles[i].Density - sim.Rho0)
 	})
 }
 
+// restPressureScale ramps the pressure force from 0 at rest density up to
+// full strength at RestPressureThreshold above it, with a smoothstep so the
+// force doesn't jump. Particles packed only slightly tighter than rest, as
+// they are in a pile on the floor, then stop pushing each other around.
+func (sim *FluidSim) restPressureScale(density float64) float64 {
+	excess := (density - sim.Rho0) / sim.Rho0
+	if excess <= 0 || excess >= sim.RestPressureThreshold {
+		return 1
+	}
+	t := excess / sim.RestPressureThreshold
+	return t * t * (3 - 2*t)
+}
+
 func (sim *FluidSim) CalculatePressureForce(p *core.Particle, pressureMultiplier float64) *core.Vector {
 	var force core.Vector
 
@@ -116,7 +449,7 @@ func (sim *FluidSim) CalculatePressureForce(p *core.Particle, pressureMultiplier
 		dy := neighbor.Y - p.Y
 		r2 := dx*dx + dy*dy + spatial.EPSILON
 
-		gradW := spatial.SmoothingKernelGradient(neighbor)
+		gradW := spatial.SmoothingKernelGradient(neighbor, sim.InteractionRadius)
 
 		forceContribution := &gradW
 		forceContribution.MultiplyByScalar((p.Pressure + neighbor.Pressure) / (2 * r2))
@@ -127,6 +460,39 @@ func (sim *FluidSim) CalculatePressureForce(p *core.Particle, pressureMultiplier
 	return &force
 }
 
+// CalculateCorrectPressureForce is the standard SPH pressure acceleration,
+//
+//	a_i = -sum_j m_j (P_i/rho_i^2 + P_j/rho_j^2) gradW(r_ij),
+//
+// with gradW the gradient of the kernel at the pair's separation, for
+// particle i and the indices of its neighbors. Each neighbor pushes in
+// proportion to its mass, and a pair pushes each other with equal and
+// opposite forces, m_i a_i = -m_j a_j, so pressure conserves momentum. The
+// pressures already carry the pressure multiplier.
+//
+// Neighbors are read from Particles by index rather than from the copies in
+// the neighbor lists, which were taken before this step's densities and
+// pressures were computed.
+func (sim *FluidSim) CalculateCorrectPressureForce(i int, neighbors []int) *core.Vector {
+	var force core.Vector
+	p := &sim.Particles[i]
+	pi := p.Pressure / (p.Density * p.Density)
+
+	for _, j := range neighbors {
+		q := &sim.Particles[j]
+		dx, dy := sim.separation(p, q)
+		r := math.Sqrt(dx*dx + dy*dy)
+		if r < spatial.EPSILON {
+			continue // no direction to push along
+		}
+		dW := spatial.SmoothingKernelDerivative(sim.InteractionRadius, r)
+		scale := -q.Mass * (pi + q.Pressure/(q.Density*q.Density)) * dW / r
+		force.X += scale * dx
+		force.Y += scale * dy
+	}
+	return &force
+}
+
 func (sim *FluidSim) CalculateViscosityForce(p *core.Particle) *core.Vector {
 	var force core.Vector
 
@@ -134,7 +500,7 @@ func (sim *FluidSim) CalculateViscosityForce(p *core.Particle) *core.Vector {
 		dx := neighbor.X - p.X
 		dy := neighbor.Y - p.Y
 		velocityDiff := (neighbor.Vx - p.Vx) + (neighbor.Vy - p.Vy)
-		lapW := spatial.SmoothingKernelLaplacian(*p)
+		lapW := spatial.SmoothingKernelLaplacian(*p, sim.InteractionRadius)
 
 		forceContribution := &core.Vector{X: dx, Y: dy}
 		forceContribution.MultiplyByScalar(lapW * sim.Nu * velocityDiff)
@@ -145,6 +511,44 @@ func (sim *FluidSim) CalculateViscosityForce(p *core.Particle) *core.Vector {
 	return &force
 }
 
+// CalculateCorrectViscosityForce is the SPH viscosity acceleration of
+// Morris et al.,
+//
+//	a_i = sum_j m_j nu (rho_i + rho_j) / (rho_i rho_j) * dW/dr / r * v_ij,
+//
+// with v_ij = v_i - v_j and r softened by a hundredth of the support radius.
+// It is the Laplacian of the velocity times Nu, so a shear decays at the
+// rate the Navier-Stokes equations give; a pair pulls each other's velocity
+// together with equal and opposite forces, conserving momentum.
+//
+// It reads the copies in p's neighbor list, which include periodic images.
+// Their densities are a step old, or unset before the first density pass,
+// in which case p's own density stands in.
+func (sim *FluidSim) CalculateCorrectViscosityForce(p *core.Particle) *core.Vector {
+	var force core.Vector
+	if p.Density <= 0 {
+		return &force
+	}
+	h := sim.InteractionRadius
+	for _, q := range p.Neighbors {
+		dx, dy := p.X-q.X, p.Y-q.Y
+		r2 := dx*dx + dy*dy
+		if r2 < spatial.EPSILON {
+			continue // p itself
+		}
+		r := math.Sqrt(r2)
+		rho := q.Density
+		if rho <= 0 {
+			rho = p.Density
+		}
+		dW := spatial.SmoothingKernelDerivative(h, r)
+		scale := q.Mass * sim.Nu * (p.Density + rho) / (p.Density * rho) * dW * r / (r2 + 0.01*h*h)
+		force.X += scale * (p.Vx - q.Vx)
+		force.Y += scale * (p.Vy - q.Vy)
+	}
+	return &force
+}
+
 func (sim *FluidSim) CalculateRepulsionForce(p *core.Particle, pressureMultiplier float64) *core.Vector {
 	repulsionForce := &core.Vector{X: 0, Y: 0}
 	for _, neighbor := range p.Neighbors {
@@ -162,79 +566,265 @@ func (sim *FluidSim) CalculateRepulsionForce(p *core.Particle, pressureMultiplie
 }
 
 func (sim *FluidSim) UpdateForces(gravity, pressureMultiplier float64) {
+	var neighbors [][]int
+	if sim.CorrectPressureForce {
+		neighbors = sim.neighborIndexLists()
+	}
 	for i := range sim.Particles {
 		// Step 1: Reset forces and apply gravitational force
 		sim.Particles[i].Force = core.Vector{X: 0, Y: -sim.Particles[i].Density * gravity}
 
 		// Step 2: Calculate and apply pressure and viscosity forces
 		p1 := &sim.Particles[i]
-		pressureForce := sim.CalculatePressureForce(p1, pressureMultiplier)
-		viscosityForce := sim.CalculateViscosityForce(p1)
-		repulsionForce := sim.CalculateRepulsionForce(p1, pressureMultiplier)
+		var pressureForce *core.Vector
+		if sim.CorrectPressureForce {
+			pressureForce = sim.CalculateCorrectPressureForce(i, neighbors[i])
+		} else {
+			pressureForce = sim.CalculatePressureForce(p1, pressureMultiplier)
+		}
+		var viscosityForce *core.Vector
+		if sim.CorrectViscosityForce {
+			viscosityForce = sim.CalculateCorrectViscosityForce(p1)
+		} else {
+			viscosityForce = sim.CalculateViscosityForce(p1)
+		}
+		var repulsionForce *core.Vector
+		if sim.NoDensityRepulsion {
+			repulsionForce = &core.Vector{}
+		} else {
+			repulsionForce = sim.CalculateRepulsionForce(p1, pressureMultiplier)
+		}
+		if sim.RestPressureThreshold > 0 {
+			pressureForce.Multiply(sim.restPressureScale(p1.Density))
+		}
 
 		// Step 3: Aggregate all forces
 		sim.Particles[i].Force.Add(pressureForce)
 		sim.Particles[i].Force.Add(viscosityForce)
 		sim.Particles[i].Force.Add(repulsionForce)
+		if sim.Adhesion != 0 {
+			adhesionForce := sim.CalculateAdhesionForce(p1)
+			sim.Particles[i].Force.Add(&adhesionForce)
+		}
 	}
 }
 
-func (sim *FluidSim) Integrate() {
-	parallelFor(0, len(sim.Particles), func(i int) {
-		p := &sim.Particles[i]
+// Integrate advances velocities by the forces and positions by the new
+// velocities, then applies the walls. By default particles are updated in
+// place; with DoubleBuffer each update is written to a shadow copy that is
+// swapped in once every particle is done, so nothing reading Particles
+// during the pass sees a half-updated state. The swap replaces the
+// Particles slice, so pointers into it don't survive an Integrate.
+func (sim *FluidSim) Integrate(dt float64) {
+	var clamped int64
+	n := len(sim.Particles)
+	impacts := sim.impactBuffer(n)
+	integrate := func(i int, p *core.Particle) {
+		wasClamped, impact := sim.integrateParticle(p, dt)
+		if wasClamped {
+			atomic.AddInt64(&clamped, 1)
+		}
+		if impacts != nil {
+			impacts[i] = impact
+		}
+	}
+	if sim.DoubleBuffer {
+		if cap(sim.nextParticles) < n {
+			sim.nextParticles = make([]core.Particle, n)
+		}
+		next := sim.nextParticles[:n]
+		sim.parallelFor(0, n, func(i int) {
+			next[i] = sim.Particles[i]
+			integrate(i, &next[i])
+		})
+		sim.Particles, sim.nextParticles = next, sim.Particles
+	} else {
+		sim.parallelFor(0, n, func(i int) {
+			integrate(i, &sim.Particles[i])
+		})
+	}
+	sim.Clamped = int(clamped)
+	sim.recordSplashes(impacts)
+}
 
-		// Update velocities
-		p.Vx += p.Force.X * sim.Dt
-		p.Vy += p.Force.Y * sim.Dt
+// integrateParticle steps one particle, reporting whether its speed was
+// clamped to MaxSpeed and how fast it hit a wall, 0 if it didn't.
+func (sim *FluidSim) integrateParticle(p *core.Particle, dt float64) (bool, float64) {
+	// Update velocities
+	p.Vx += p.Force.X * dt
+	p.Vy += p.Force.Y * dt
+
+	// Cap runaway speeds
+	clamped := false
+	if sim.MaxSpeed > 0 {
+		if speed := math.Hypot(p.Vx, p.Vy); speed > sim.MaxSpeed {
+			scale := sim.MaxSpeed / speed
+			p.Vx *= scale
+			p.Vy *= scale
+			clamped = true
+		}
+	}
 
-		// Update positions
-		p.X += p.Vx * sim.Dt
-		p.Y += p.Vy * sim.Dt
+	// Update positions
+	p.X += p.Vx * dt
+	p.Y += p.Vy * dt
 
-		// Handle boundaries
-		spatial.HandleBoundary(&p.X, &p.Vx, sim.Domain.X, sim.LeftBoundary)
-		spatial.HandleBoundary(&p.Y, &p.Vy, sim.Domain.Y, sim.TopBoundary)
-	})
+	// Handle boundaries
+	impact := math.Max(
+		spatial.HandleBoundaryWithRestitution(&p.X, &p.Vx, sim.Domain.X, sim.LeftBoundary, sim.Restitution),
+		spatial.HandleBoundaryWithRestitution(&p.Y, &p.Vy, sim.Domain.Y, sim.TopBoundary, sim.Restitution))
+	if sim.Domain.Shape == Circle {
+		impact = math.Max(impact, sim.Domain.reflectCircle(&p.X, &p.Y, &p.Vx, &p.Vy, sim.Restitution))
+	}
+	return clamped, impact
 }
 
 func (sim *FluidSim) CalculatePressureStats() (float64, float64) {
-	var meanPressure, stdPressure float64
-	var meanSum, stdSum float64
-	n := len(sim.Particles)
-	meanMux := &sync.Mutex{}
-	stdMux := &sync.Mutex{}
+	return pressureStats(sim.parallel(), sim.Particles)
+}
 
-	parallelFor(0, n, func(i int) {
-		meanMux.Lock()
-		meanSum += sim.Particles[i].Pressure
-		meanMux.Unlock()
-	})
+// pressureStats returns the mean and population standard deviation of the
+// particle pressures. The sums are float64 reductions with per-worker partials
+// combined in a fixed order, so there is no lock contention, no fixed-point
+// overflow limit, and the result doesn't depend on scheduling. An empty slice
+// reports zeros rather than NaN.
+func pressureStats(config ParallelConfig, particles []core.Particle) (float64, float64) {
+	n := len(particles)
+	if n == 0 {
+		return 0, 0
+	}
+
+	meanPressure := config.parallelReduce(0, n, 0, func(i int) float64 {
+		return particles[i].Pressure
+	}, sum) / float64(n)
 
-	meanPressure = meanSum / float64(n)
+	variance := config.parallelReduce(0, n, 0, func(i int) float64 {
+		d := particles[i].Pressure - meanPressure
+		return d * d
+	}, sum) / float64(n)
 
-	parallelFor(0, n, func(i int) {
-		d := sim.Particles[i].Pressure - meanPressure
-		stdMux.Lock()
-		stdSum += d * d
-		stdMux.Unlock()
+	return meanPressure, math.Sqrt(variance)
+}
+
+// velocity retained per settling step; heavy drag bleeds off the energy of
+// the random initial placement
+const settleDrag = 0.5
+
+// SettleStep advances one step with gravity off and heavy drag so randomly
+// placed particles spread out and come to rest.
+func (sim *FluidSim) SettleStep(pressureMultiplier, dt float64) {
+	sim.Advance(0, pressureMultiplier, dt)
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		sim.Particles[i].Vx *= settleDrag
+		sim.Particles[i].Vy *= settleDrag
 	})
+}
+
+// Settle runs SettleStep the given number of times.
+func (sim *FluidSim) Settle(steps int, pressureMultiplier, dt float64) {
+	for i := 0; i < steps; i++ {
+		sim.SettleStep(pressureMultiplier, dt)
+	}
+}
 
-	stdPressure = math.Sqrt(stdSum / float64(n))
+// PackingSpacing is the particle spacing of a uniform packing that fills the
+// domain, used as the particle diameter when relaxing the initial placement.
+func (sim *FluidSim) PackingSpacing() float64 {
+	if len(sim.Particles) == 0 {
+		return 0
+	}
+	return math.Sqrt(sim.Domain.Area() / float64(len(sim.Particles)))
+}
 
-	return meanPressure, stdPressure
+// RelaxPacking pushes overlapping particles apart for the given number of
+// iterations using pure short-range repulsion: any pair closer than
+// PackingSpacing is separated by half their overlap each. Positions are
+// updated Jacobi-style so the result doesn't depend on particle order, and
+// velocities are left untouched. Gravity and pressure play no part.
+func (sim *FluidSim) RelaxPacking(iterations int) {
+	spacing := sim.PackingSpacing()
+	if spacing == 0 {
+		return
+	}
+	grid := spatial.NewNeighborGrid(sim.GridType, spacing, int(sim.Domain.X), int(sim.Domain.Y))
+	shift := make([]core.Vector, len(sim.Particles))
+
+	for iter := 0; iter < iterations; iter++ {
+		grid.Update(sim.Particles)
+		sim.parallelRange(0, len(sim.Particles), func(_, lo, hi int) {
+			var candidates []int
+			for i := lo; i < hi; i++ {
+				p := &sim.Particles[i]
+				shift[i] = core.Vector{}
+				candidates = grid.GetNeighborParticles(p.X, p.Y, candidates[:0])
+				for _, j := range candidates {
+					if j == i {
+						continue
+					}
+					dx := p.X - sim.Particles[j].X
+					dy := p.Y - sim.Particles[j].Y
+					dist := math.Sqrt(dx*dx + dy*dy)
+					if dist >= spacing || dist == 0 {
+						continue
+					}
+					overlap := 0.5 * (spacing - dist) / dist
+					shift[i].X += dx * overlap
+					shift[i].Y += dy * overlap
+				}
+			}
+		})
+		sim.parallelFor(0, len(sim.Particles), func(i int) {
+			p := &sim.Particles[i]
+			p.X = spatial.Clamp(p.X+shift[i].X, spatial.EPSILON, sim.Domain.X-spatial.EPSILON)
+			p.Y = spatial.Clamp(p.Y+shift[i].Y, spatial.EPSILON, sim.Domain.Y-spatial.EPSILON)
+			if sim.Domain.Shape == Circle {
+				sim.Domain.confineCircle(&p.X, &p.Y)
+			}
+		})
+	}
 }
 
 // ####################################################################################################
 
-func (sim *FluidSim) Step(gravity, pressureMultiplier, dt float64) (float64, float64) {
+// Advance moves the simulation forward by dt without computing statistics,
+// so callers running several substeps per frame only pay for them once.
+func (sim *FluidSim) Advance(gravity, pressureMultiplier, dt float64) {
+	sim.RecordPositions()
 	sim.PredictPositions(dt)
-	sim.Grid.Update(sim.Particles)
+	if sim.NeighborSkin == 0 || sim.neighborCacheStale() {
+		sim.Grid.Update(sim.Particles)
+	}
 	sim.FindNeighbors()
 	sim.UpdateDensities()
 	sim.UpdatePressure(pressureMultiplier)
-	sim.UpdateForces(gravity, pressureMultiplier)
-	sim.Integrate()
+	if sim.Material == Granular {
+		sim.UpdateGranularForces(gravity, dt)
+	} else {
+		sim.UpdateForces(gravity, pressureMultiplier)
+	}
+	sim.ApplyContactFriction()
+	// the equation of state is a single pass; the divergence projection is
+	// the only iterative solve
+	sim.Iterations = 1
+	if sim.DivergenceFree && sim.Material == Fluid {
+		sim.ProjectDivergenceFree(dt)
+		sim.Iterations += sim.DivergenceIterations
+	}
+	sim.Integrate(dt)
+	sim.EnforceMinDistance()
+	if sim.Piston != nil {
+		sim.applyPiston(dt)
+	}
+	if sim.Tunnel != nil {
+		sim.applyTunnel()
+	}
+	sim.checkEscape()
+	sim.ageParticles(dt)
+}
 
-	meanPressure, stdPressure := sim.CalculatePressureStats()
-	return meanPressure, stdPressure
+// Step advances by dt and returns the mean and standard deviation of the
+// pressure; it is StepWith with a single substep.
+func (sim *FluidSim) Step(gravity, pressureMultiplier, dt float64) (float64, float64) {
+	result := sim.StepWith(StepParams{Gravity: gravity, PressureMultiplier: pressureMultiplier, Dt: dt})
+	return result.MeanPressure, result.StdPressure
 }
@@ -0,0 +1,414 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fluids/spatial"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// newLatticeSim places particles on a square lattice with the given spacing
+// and builds the grid for interaction radius h.
+func newLatticeSim(side int, spacing, h float64) *FluidSim {
+	domain := Domain{X: float64(side) * spacing, Y: float64(side) * spacing}
+	sim := NewFluidSim(side*side, domain, 0.0005, 1.0, 1.0)
+	for i := 0; i < side; i++ {
+		for j := 0; j < side; j++ {
+			sim.Particles[i*side+j] = core.Particle{
+				X:    (float64(i) + 0.5) * spacing,
+				Y:    (float64(j) + 0.5) * spacing,
+				Mass: 1,
+			}
+		}
+	}
+	sim.InteractionRadius = h
+	sim.Grid = spatial.NewGrid(h, int(domain.X), int(domain.Y))
+	return sim
+}
+
+// The radius must span a few lattice spacings for the particle sum to
+// approximate the kernel integral.
+func TestUniformDensityIndependentOfRadius(t *testing.T) {
+	const side = 41
+	const spacing = 1.0
+	for _, h := range []float64{spatial.SMOOTHING_RADIUS, 6, 8} {
+		sim := newLatticeSim(side, spacing, h)
+		sim.Grid.Update(sim.Particles)
+		sim.FindNeighbors()
+		sim.UpdateDensities()
+
+		center := sim.Particles[(side/2)*side+side/2]
+		want := 1 / (spacing * spacing)
+		if math.Abs(center.Density-want) > 0.05*want {
+			t.Errorf("h=%v: interior density %v, want ~%v", h, center.Density, want)
+		}
+	}
+}
+
+func TestDensityRadiusCutsOffTheKernel(t *testing.T) {
+	const side = 21
+	sim := newLatticeSim(side, 1, 8)
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+	sim.UpdateDensities()
+	full := sim.Particles[(side/2)*side+side/2].Density
+
+	// equal radii are the same as leaving DensityRadius unset
+	sim.DensityRadius = sim.InteractionRadius
+	sim.UpdateDensities()
+	if got := sim.Particles[(side/2)*side+side/2].Density; got != full {
+		t.Errorf("DensityRadius equal to InteractionRadius gives density %v, want %v", got, full)
+	}
+
+	// a smaller support only counts neighbors inside it
+	sim.DensityRadius = 3
+	sim.UpdateDensities()
+	center := sim.Particles[(side/2)*side+side/2]
+	want := 0.0
+	for _, p := range sim.Particles {
+		if d := math.Hypot(p.X-center.X, p.Y-center.Y); d < 3 {
+			want += p.Mass * spatial.SmoothingKernel(3, d)
+		}
+	}
+	if math.Abs(center.Density-want) > 1e-12 {
+		t.Errorf("density with a radius 3 kernel is %v, want %v", center.Density, want)
+	}
+	if len(center.Neighbors) <= 29 {
+		t.Errorf("neighbor search found %d neighbors, want the full radius 8 search", len(center.Neighbors))
+	}
+}
+
+func TestAddRemoveParticlesKeepsSimStable(t *testing.T) {
+	sim := NewFluidSim(200, Domain{X: 100, Y: 100}, 0.0005, 1.0, 1.0)
+	sim.Step(0, 10000, sim.Dt)
+
+	sim.AddParticles(500)
+	if sim.N != 700 || len(sim.Particles) != 700 {
+		t.Fatalf("after adding: N=%d len=%d, want 700", sim.N, len(sim.Particles))
+	}
+	for _, p := range sim.Particles[200:] {
+		if p.X < 0 || p.X > sim.Domain.X || p.Y < 0 || p.Y > sim.Domain.Y {
+			t.Fatalf("spawned particle out of bounds at (%v, %v)", p.X, p.Y)
+		}
+	}
+	sim.Step(0, 10000, sim.Dt)
+
+	sim.RemoveParticles(650)
+	if sim.N != 50 {
+		t.Fatalf("after removing: N=%d, want 50", sim.N)
+	}
+	mean, std := sim.Step(0, 10000, sim.Dt)
+	if math.IsNaN(mean) || math.IsNaN(std) {
+		t.Errorf("stats became NaN after resize")
+	}
+
+	sim.RemoveParticles(1000)
+	if sim.N != 0 {
+		t.Errorf("removing more than exist left N=%d", sim.N)
+	}
+}
+
+func nearestNeighborDistances(particles []core.Particle) []float64 {
+	dists := make([]float64, len(particles))
+	for i := range particles {
+		dists[i] = math.Inf(1)
+		for j := range particles {
+			if i != j {
+				d := core.CalculateDistance(particles[i], particles[j])
+				dists[i] = math.Min(dists[i], d)
+			}
+		}
+	}
+	return dists
+}
+
+func TestRelaxPackingSeparatesParticles(t *testing.T) {
+	sim := NewFluidSim(400, Domain{X: 100, Y: 100}, 0.0005, 1.0, 1.0)
+	spacing := sim.PackingSpacing()
+	sim.RelaxPacking(50)
+
+	mean, min := 0.0, math.Inf(1)
+	for _, d := range nearestNeighborDistances(sim.Particles) {
+		mean += d
+		min = math.Min(min, d)
+	}
+	mean /= float64(len(sim.Particles))
+	if math.Abs(mean-spacing) > 0.2*spacing {
+		t.Errorf("mean nearest-neighbor distance %v, want ~%v", mean, spacing)
+	}
+	if min < 0.5*spacing {
+		t.Errorf("closest pair %v apart, want at least %v", min, 0.5*spacing)
+	}
+}
+
+func TestFreezeStopsAllMotion(t *testing.T) {
+	sim := NewFluidSim(300, Domain{X: 100, Y: 100}, 0.0005, 1.0, 1.0)
+	for i := range sim.Particles {
+		sim.Particles[i].Vx, sim.Particles[i].Vy = 10, -5
+	}
+	sim.Freeze()
+	for i, p := range sim.Particles {
+		if p.Vx != 0 || p.Vy != 0 {
+			t.Fatalf("particle %d still moving at (%v, %v)", i, p.Vx, p.Vy)
+		}
+	}
+}
+
+func TestRadiusVariation(t *testing.T) {
+	sim := NewFluidSim(200, Domain{X: 100, Y: 100}, 0.0005, 1.0, 1.0)
+	for _, p := range sim.Particles {
+		if p.Radius != sim.RadiusBase || p.Mass != 1 {
+			t.Fatalf("default particle has radius %v mass %v, want %v and 1", p.Radius, p.Mass, sim.RadiusBase)
+		}
+	}
+
+	sim.SetRadii(2, 0.4)
+	varied := false
+	for _, p := range sim.Particles {
+		if p.Radius < 2*0.8 || p.Radius > 2*1.2 {
+			t.Fatalf("radius %v outside 2 * (1 ± 0.2)", p.Radius)
+		}
+		if want := (p.Radius / 2) * (p.Radius / 2); math.Abs(p.Mass-want) > 1e-12 {
+			t.Fatalf("mass %v for radius %v, want %v", p.Mass, p.Radius, want)
+		}
+		varied = varied || p.Radius != 2
+	}
+	if !varied {
+		t.Errorf("variation 0.4 produced identical radii")
+	}
+}
+
+func TestFindNeighborsReusesLists(t *testing.T) {
+	sim := newLatticeSim(20, 1.0, spatial.SMOOTHING_RADIUS)
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+
+	// a disc of radius 4 around an interior lattice site holds about 48 sites
+	if sim.PeakNeighbors < 40 || sim.PeakNeighbors > 60 {
+		t.Errorf("PeakNeighbors = %d, want about 49", sim.PeakNeighbors)
+	}
+	// once the lists have grown nothing is allocated
+	if allocs := testing.AllocsPerRun(10, sim.FindNeighbors); allocs != 0 {
+		t.Errorf("FindNeighbors allocated %v times per call after warm-up", allocs)
+	}
+}
+
+func TestSetInteractionRadiusFindsAllNeighbors(t *testing.T) {
+	sim := newLatticeSim(20, 1.0, spatial.SMOOTHING_RADIUS)
+	sim.SetInteractionRadius(7)
+
+	// with the grid's cells still 4 wide, a 3x3 block of cells would miss
+	// lattice sites between 4 and 7 away
+	h2 := sim.InteractionRadius * sim.InteractionRadius
+	for i, p := range sim.Particles {
+		want := 0
+		for _, q := range sim.Particles {
+			if dx, dy := p.X-q.X, p.Y-q.Y; dx*dx+dy*dy < h2 {
+				want++
+			}
+		}
+		if got := len(p.Neighbors); got != want {
+			t.Fatalf("particle %d has %d neighbors within radius 7, want %d", i, got, want)
+		}
+	}
+}
+
+func BenchmarkFindNeighbors(b *testing.B) {
+	for _, hint := range []int{0, defaultNeighborCapacity, 64} {
+		b.Run(fmt.Sprintf("hint=%d", hint), func(b *testing.B) {
+			sim := newLatticeSim(40, 1.0, spatial.SMOOTHING_RADIUS)
+			sim.SetNeighborCapacityHint(hint)
+			sim.Grid.Update(sim.Particles)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sim.FindNeighbors()
+			}
+		})
+	}
+}
+
+func TestDoubleBufferMatchesInPlace(t *testing.T) {
+	newSim := func(double bool) *FluidSim {
+		sim := newLatticeSim(12, 1.0, spatial.SMOOTHING_RADIUS)
+		sim.DoubleBuffer = double
+		sim.MaxSpeed = 5
+		for i := range sim.Particles {
+			sim.Particles[i].Vx = float64(i%7) - 3
+		}
+		return sim
+	}
+	single, double := newSim(false), newSim(true)
+	for step := 0; step < 20; step++ {
+		single.Advance(-1000, 10000, 0.0005)
+		double.Advance(-1000, 10000, 0.0005)
+		if single.Clamped != double.Clamped {
+			t.Fatalf("step %d: %d clamped in place, %d double-buffered", step, single.Clamped, double.Clamped)
+		}
+	}
+	for i := range single.Particles {
+		a, b := single.Particles[i], double.Particles[i]
+		if a.X != b.X || a.Y != b.Y || a.Vx != b.Vx || a.Vy != b.Vy {
+			t.Fatalf("particle %d differs: (%g, %g) in place, (%g, %g) double-buffered", i, a.X, a.Y, b.X, b.Y)
+		}
+	}
+}
+
+func BenchmarkIntegrate(b *testing.B) {
+	for _, double := range []bool{false, true} {
+		b.Run(fmt.Sprintf("double=%v", double), func(b *testing.B) {
+			sim := newLatticeSim(100, 1.0, spatial.SMOOTHING_RADIUS)
+			sim.DoubleBuffer = double
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sim.Integrate(1e-9)
+			}
+		})
+	}
+}
+
+func TestElasticWallsConserveKineticEnergy(t *testing.T) {
+	sim := NewFluidSim(300, Domain{X: 20, Y: 20}, 0.001, 1, 1)
+	sim.ApplyInitialCondition(func(i, n int) (x, y, vx, vy float64) {
+		x, y, _, _ = RandomStillInitialCondition(i, sim.Domain)
+		return x, y, float64(i%17) - 8, float64(i%11) - 5
+	})
+	sim.Restitution = 1
+	before := sim.KineticEnergy()
+
+	// free flight: no forces, only wall bounces
+	for step := 0; step < 5000; step++ {
+		sim.Integrate(sim.Dt)
+	}
+	if after := sim.KineticEnergy(); math.Abs(after-before) > 1e-9*before {
+		t.Errorf("kinetic energy %v after bouncing, want %v", after, before)
+	}
+
+	sim.Restitution = 0.5
+	sim.Particles = []core.Particle{{X: 19.99, Y: 10, Vx: 20, Mass: 1}}
+	sim.Integrate(sim.Dt)
+	if vx := sim.Particles[0].Vx; vx != -10 {
+		t.Errorf("damped bounce left vx = %v, want -10", vx)
+	}
+}
+
+func TestMaxSpeedClamp(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	sim.MaxSpeed = 50
+	sim.Particles = []core.Particle{
+		{X: 50, Y: 50, Vx: 3000, Vy: -4000, Mass: 1},
+		{X: 20, Y: 20, Vx: 30, Vy: 40, Mass: 1},
+	}
+	sim.Integrate(sim.Dt)
+
+	fast, slow := sim.Particles[0], sim.Particles[1]
+	if speed := math.Hypot(fast.Vx, fast.Vy); math.Abs(speed-50) > 1e-9 {
+		t.Errorf("fast particle clamped to speed %v, want 50", speed)
+	}
+	if math.Abs(fast.Vx/fast.Vy+0.75) > 1e-12 {
+		t.Errorf("clamping changed direction to (%v, %v)", fast.Vx, fast.Vy)
+	}
+	if slow.Vx != 30 || slow.Vy != 40 {
+		t.Errorf("particle at the limit changed to (%v, %v)", slow.Vx, slow.Vy)
+	}
+	if sim.Clamped != 1 {
+		t.Errorf("Clamped = %d, want 1", sim.Clamped)
+	}
+}
+
+func TestRestPressureScale(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 10, Y: 10}, 0.0005, 2, 1)
+	sim.RestPressureThreshold = 0.1
+	cases := []struct{ density, want float64 }{
+		{1.5, 1},   // below rest: untouched
+		{2, 1},     // exactly at rest
+		{2.1, 0.5}, // halfway up the ramp
+		{2.2, 1},   // at the threshold
+		{3, 1},     // well above
+	}
+	for _, c := range cases {
+		if got := sim.restPressureScale(c.density); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("scale at density %v = %v, want %v", c.density, got, c.want)
+		}
+	}
+	if low, high := sim.restPressureScale(2.02), sim.restPressureScale(2.18); !(0 < low && low < high && high < 1) {
+		t.Errorf("ramp not increasing: %v at 2.02, %v at 2.18", low, high)
+	}
+}
+
+func TestCorrectPressureForceScalesWithMass(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	pushFrom := func(mass float64) core.Vector {
+		sim.Particles = []core.Particle{
+			{X: 10, Y: 10, Mass: 1, Density: 1.2, Pressure: 50},
+			{X: 11, Y: 10, Mass: mass, Density: 1.2, Pressure: 50},
+		}
+		return *sim.CalculateCorrectPressureForce(0, []int{1})
+	}
+	light, heavy := pushFrom(1), pushFrom(2)
+	if !(light.X < 0) || light.Y != 0 {
+		t.Fatalf("pressure pushed the particle along %v, want away from its neighbor", light)
+	}
+	if math.Abs(heavy.X-2*light.X) > 1e-12*math.Abs(light.X) {
+		t.Errorf("a neighbor of twice the mass pushes with %v, want twice %v", heavy.X, light.X)
+	}
+
+	// with densities and pressures from the usual pipeline, a pair's forces
+	// are equal and opposite once weighted by mass; the low rest density
+	// puts the pair under positive pressure
+	sim.Rho0 = 0.01
+	sim.Particles = []core.Particle{
+		{X: 10, Y: 10, Mass: 1},
+		{X: 11, Y: 10.5, Mass: 3},
+	}
+	sim.Grid.Update(sim.Particles)
+	sim.FindNeighbors()
+	sim.UpdateDensities()
+	sim.UpdatePressure(100)
+	a := sim.CalculateCorrectPressureForce(0, []int{1})
+	b := sim.CalculateCorrectPressureForce(1, []int{0})
+	if !(a.X < 0) {
+		t.Fatalf("pressure on the lighter particle %v, want a finite push away", a)
+	}
+	if dx, dy := a.X+3*b.X, a.Y+3*b.Y; math.Abs(dx) > 1e-9*math.Abs(a.X) || math.Abs(dy) > 1e-9*math.Abs(a.Y) {
+		t.Errorf("m_i a_i + m_j a_j = (%v, %v), want 0", dx, dy)
+	}
+}
+
+func TestAddBlockFillsAroundExistingFluid(t *testing.T) {
+	sim := NewFluidSim(0, Domain{X: 40, Y: 40}, 0.0005, 1, 1)
+	if added := sim.AddBlock(10, 10, 10, 10, 2); added != 25 {
+		t.Fatalf("10x10 block at spacing 2 added %d particles, want 25", added)
+	}
+	// a second block overlapping the first only fills the free half
+	added := sim.AddBlock(15, 10, 10, 10, 2)
+	if added == 0 || added >= 25 {
+		t.Fatalf("overlapping block added %d particles, want some but not all 25", added)
+	}
+	// and one hanging off the edge of the domain is cut off at the wall
+	if added := sim.AddBlock(36, 0, 8, 2, 2); added != 2 {
+		t.Errorf("block straddling the wall added %d particles, want the 2 inside", added)
+	}
+
+	seen := map[int]bool{}
+	for i, p := range sim.Particles {
+		if seen[p.ID] {
+			t.Fatalf("particle ID %d used twice", p.ID)
+		}
+		seen[p.ID] = true
+		if p.Vx != 0 || p.Vy != 0 || p.Mass != 1 || p.Density != sim.Rho0 {
+			t.Fatalf("particle %d added as %+v, want at rest with unit mass and rest density", i, p)
+		}
+		for j := 0; j < i; j++ {
+			q := sim.Particles[j]
+			if d := math.Hypot(p.X-q.X, p.Y-q.Y); d < 2-1e-9 {
+				t.Fatalf("particles %d and %d only %v apart, want at least the spacing 2", j, i, d)
+			}
+		}
+	}
+	if sim.N != len(sim.Particles) {
+		t.Errorf("N = %d, want %d", sim.N, len(sim.Particles))
+	}
+}
@@ -0,0 +1,57 @@
+package simulation
+
+// MaxSplashesPerStep caps how many wall impacts one Integrate records, so a
+// whole wave slamming into a wall yields a handful of splashes, not one per
+// particle.
+const MaxSplashesPerStep = 4
+
+// Splash is a particle hitting a wall faster than SplashSpeed: where it was
+// after the bounce and how fast it hit.
+type Splash struct {
+	X, Y  float64
+	Speed float64
+}
+
+// impactBuffer returns a zeroed per-particle impact speed slice for
+// Integrate, or nil when splashes are off so the fast path does nothing extra.
+func (sim *FluidSim) impactBuffer(n int) []float64 {
+	if sim.SplashSpeed <= 0 {
+		sim.Splashes = sim.Splashes[:0]
+		return nil
+	}
+	if cap(sim.impacts) < n {
+		sim.impacts = make([]float64, n)
+	}
+	impacts := sim.impacts[:n]
+	for i := range impacts {
+		impacts[i] = 0
+	}
+	return impacts
+}
+
+// recordSplashes replaces Splashes with the fastest impacts above
+// SplashSpeed, at most MaxSplashesPerStep of them, fastest first.
+func (sim *FluidSim) recordSplashes(impacts []float64) {
+	splashes := sim.Splashes[:0]
+	for i, speed := range impacts {
+		if speed <= sim.SplashSpeed {
+			continue
+		}
+		if len(splashes) == MaxSplashesPerStep {
+			if speed <= splashes[len(splashes)-1].Speed {
+				continue
+			}
+			splashes = splashes[:len(splashes)-1]
+		}
+		// insert in order of speed; the list is short
+		k := len(splashes)
+		splashes = append(splashes, Splash{})
+		for k > 0 && splashes[k-1].Speed < speed {
+			splashes[k] = splashes[k-1]
+			k--
+		}
+		p := &sim.Particles[i]
+		splashes[k] = Splash{X: p.X, Y: p.Y, Speed: speed}
+	}
+	sim.Splashes = splashes
+}
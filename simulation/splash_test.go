@@ -0,0 +1,44 @@
+package simulation
+
+import "testing"
+
+// wallHitters sends particle i toward the right wall at speed 10*(i+1),
+// close enough that every one of them hits it this step.
+func wallHitters(n int, splashSpeed float64) *FluidSim {
+	sim := NewFluidSim(n, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.SplashSpeed = splashSpeed
+	sim.ApplyInitialCondition(func(i, n int) (float64, float64, float64, float64) {
+		return 19.99, 1 + float64(i)*18/float64(n), 10 * float64(i+1), 0
+	})
+	return sim
+}
+
+func TestSplashesKeepTheHardestImpacts(t *testing.T) {
+	sim := wallHitters(20, 45)
+	sim.Integrate(0.01)
+	if len(sim.Splashes) != MaxSplashesPerStep {
+		t.Fatalf("recorded %d splashes, want the cap of %d", len(sim.Splashes), MaxSplashesPerStep)
+	}
+	for k, splash := range sim.Splashes {
+		if want := float64(10 * (20 - k)); splash.Speed != want {
+			t.Errorf("splash %d hit at %g, want %g", k, splash.Speed, want)
+		}
+		if splash.X > 20 {
+			t.Errorf("splash %d recorded outside the wall at x %g", k, splash.X)
+		}
+	}
+}
+
+func TestSlowImpactsDontSplash(t *testing.T) {
+	sim := wallHitters(3, 45)
+	sim.Integrate(0.01)
+	if len(sim.Splashes) != 0 {
+		t.Errorf("impacts at 30 and below recorded %d splashes over a threshold of 45", len(sim.Splashes))
+	}
+
+	off := wallHitters(20, 0)
+	off.Integrate(0.01)
+	if len(off.Splashes) != 0 {
+		t.Errorf("splashes recorded with SplashSpeed off: %v", off.Splashes)
+	}
+}
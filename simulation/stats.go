@@ -0,0 +1,130 @@
+package simulation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fluids/core"
+	"io"
+	"math"
+	"time"
+)
+
+// StepStats is a per-step summary of the simulation state.
+type StepStats struct {
+	Step          int     `json:"step"`
+	MeanPressure  float64 `json:"mean_pressure"`
+	StdPressure   float64 `json:"std_pressure"`
+	MeanVelocity  float64 `json:"mean_velocity"`
+	KineticEnergy float64 `json:"kinetic_energy"` // sum of m v^2 / 2
+	DensityError  float64 `json:"density_error"`  // mean |rho - rho0| / rho0
+	StepSeconds   float64 `json:"step_seconds"`   // wall-clock time of the step
+	PeakNeighbors int     `json:"peak_neighbors"` // largest neighbor count seen so far
+}
+
+// ComputeStepStats summarizes the current particle state.
+// Pressure statistics are passed in since Step already computes them.
+func (sim *FluidSim) ComputeStepStats(step int, meanPressure, stdPressure float64, elapsed time.Duration) StepStats {
+	stats := StepStats{
+		Step:          step,
+		MeanPressure:  meanPressure,
+		StdPressure:   stdPressure,
+		StepSeconds:   elapsed.Seconds(),
+		PeakNeighbors: sim.PeakNeighbors,
+	}
+	n := len(sim.Particles)
+	if n == 0 {
+		return stats
+	}
+
+	var speedSum float64
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		speedSum += math.Hypot(p.Vx, p.Vy)
+	}
+	stats.MeanVelocity = speedSum / float64(n)
+	stats.KineticEnergy = sim.KineticEnergy()
+	stats.DensityError = sim.densityError()
+	return stats
+}
+
+// Throughput is the number of particle updates per second of wall-clock
+// time, len(Particles) * steps / elapsed, for comparing machines and
+// settings. It assumes the particle count was constant over the steps.
+func (sim *FluidSim) Throughput(steps int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(len(sim.Particles)) * float64(steps) / elapsed.Seconds()
+}
+
+// NormalizePressure maps a pressure into (0, 1) with a sigmoid of its z-score,
+// the scale every pressure color mapping indexes into.
+func NormalizePressure(pressure, meanPressure, stdPressure float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-(pressure-meanPressure)/stdPressure))
+}
+
+// ForceStats returns the mean and largest force magnitude over the
+// particles and the index of the particle feeling the largest, -1 if there
+// are none. A NaN force counts as the largest, since that is the one to find.
+func ForceStats(particles []core.Particle) (mean, peak float64, peakIndex int) {
+	peakIndex = -1
+	for i := range particles {
+		f := math.Hypot(particles[i].Force.X, particles[i].Force.Y)
+		if math.IsNaN(f) {
+			return math.NaN(), math.NaN(), i
+		}
+		mean += f
+		if peakIndex < 0 || f > peak {
+			peak, peakIndex = f, i
+		}
+	}
+	if len(particles) > 0 {
+		mean /= float64(len(particles))
+	}
+	return mean, peak, peakIndex
+}
+
+// NormalizeForce maps a force magnitude into [0, 1] on a log scale from 0 to
+// the peak, measured in units of the mean, so a few runaway particles show up
+// at the top of the scale without flattening everything else to 0.
+func NormalizeForce(magnitude, mean, peak float64) float64 {
+	if !(mean > 0) || !(peak > 0) {
+		return 0
+	}
+	return math.Log1p(magnitude/mean) / math.Log1p(peak/mean)
+}
+
+// StatsWriter writes StepStats as JSON lines. Output is buffered and flushed
+// every FlushEvery records so long runs don't pay for a write per step.
+type StatsWriter struct {
+	FlushEvery int
+
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	pending int
+}
+
+func NewStatsWriter(w io.Writer) *StatsWriter {
+	buf := bufio.NewWriter(w)
+	return &StatsWriter{
+		FlushEvery: 100,
+		buf:        buf,
+		enc:        json.NewEncoder(buf),
+	}
+}
+
+func (sw *StatsWriter) Write(stats StepStats) error {
+	if err := sw.enc.Encode(stats); err != nil {
+		return err
+	}
+	sw.pending++
+	if sw.pending >= sw.FlushEvery {
+		return sw.Flush()
+	}
+	return nil
+}
+
+func (sw *StatsWriter) Flush() error {
+	sw.pending = 0
+	return sw.buf.Flush()
+}
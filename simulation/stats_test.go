@@ -0,0 +1,136 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+	"testing"
+	"time"
+)
+
+func serialPressureStats(pressures []float64) (float64, float64) {
+	mean := 0.0
+	for _, p := range pressures {
+		mean += p
+	}
+	mean /= float64(len(pressures))
+	variance := 0.0
+	for _, p := range pressures {
+		variance += (p - mean) * (p - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(pressures)))
+}
+
+func simWithPressures(pressures []float64) *FluidSim {
+	sim := &FluidSim{Particles: make([]core.Particle, len(pressures))}
+	for i, p := range pressures {
+		sim.Particles[i].Pressure = p
+	}
+	return sim
+}
+
+func TestCalculatePressureStats(t *testing.T) {
+	ramp := make([]float64, 1001)
+	for i := range ramp {
+		ramp[i] = float64(i) - 500
+	}
+	outlier := make([]float64, 1000)
+	outlier[123] = 1e6
+	equal := make([]float64, 777)
+	for i := range equal {
+		equal[i] = 42.5
+	}
+	// far beyond what a fixed-point accumulator would hold per particle
+	large := make([]float64, 100000)
+	for i := range large {
+		large[i] = 1e14 + float64(i%7)*1e12
+	}
+
+	cases := map[string][]float64{
+		"equal":   equal,
+		"ramp":    ramp,
+		"outlier": outlier,
+		"single":  {17},
+		"large":   large,
+	}
+	for name, pressures := range cases {
+		wantMean, wantStd := serialPressureStats(pressures)
+		gotMean, gotStd := simWithPressures(pressures).CalculatePressureStats()
+		tol := 1e-9 * math.Max(1, math.Abs(wantMean))
+		if math.Abs(gotMean-wantMean) > tol {
+			t.Errorf("%s: mean %v, want %v", name, gotMean, wantMean)
+		}
+		if math.Abs(gotStd-wantStd) > 1e-6*math.Max(1, wantStd) {
+			t.Errorf("%s: std %v, want %v", name, gotStd, wantStd)
+		}
+	}
+}
+
+func TestCalculatePressureStatsEmpty(t *testing.T) {
+	mean, std := simWithPressures(nil).CalculatePressureStats()
+	if mean != 0 || std != 0 {
+		t.Errorf("empty sim: got (%v, %v), want (0, 0)", mean, std)
+	}
+}
+
+// A very stiff fluid: mean pressure well above anything an int64 fixed-point
+// accumulator could sum across 100k particles.
+func TestCalculatePressureStatsStiffFluid(t *testing.T) {
+	pressures := make([]float64, 100000)
+	for i := range pressures {
+		pressures[i] = 5e15
+	}
+	pressures[0] = 6e15
+	wantMean, _ := serialPressureStats(pressures)
+	gotMean, _ := simWithPressures(pressures).CalculatePressureStats()
+	if math.Abs(gotMean-wantMean) > 1e-9*wantMean {
+		t.Errorf("mean %v, want %v", gotMean, wantMean)
+	}
+}
+
+func TestStepStatsWeighEnergyByMass(t *testing.T) {
+	sim := &FluidSim{Rho0: 1, Particles: []core.Particle{
+		{Vx: 3, Vy: 4, Mass: 2, Density: 1},
+		{Vx: 1, Mass: 0.5, Density: 1},
+	}}
+	stats := sim.ComputeStepStats(0, 0, 0, 0)
+	// 2 * 25 / 2 + 0.5 * 1 / 2
+	if stats.KineticEnergy != 25.25 || stats.KineticEnergy != sim.KineticEnergy() {
+		t.Errorf("kinetic energy %v, want 25.25 from KineticEnergy", stats.KineticEnergy)
+	}
+	if stats.MeanVelocity != 3 {
+		t.Errorf("mean speed %v, want 3", stats.MeanVelocity)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	sim := NewFluidSim(500, Domain{X: 100, Y: 100}, 0.0005, 1, 1)
+	if got := sim.Throughput(200, 2*time.Second); got != 50000 {
+		t.Errorf("Throughput = %v, want 50000 particle-steps/sec", got)
+	}
+	if got := sim.Throughput(200, 0); got != 0 {
+		t.Errorf("Throughput with no elapsed time = %v, want 0", got)
+	}
+}
+
+func TestForceStatsFindsTheRunaway(t *testing.T) {
+	particles := make([]core.Particle, 10)
+	for i := range particles {
+		particles[i].Force = core.Vector{X: 3, Y: 4}
+	}
+	particles[6].Force = core.Vector{X: 0, Y: -500}
+	mean, peak, at := ForceStats(particles)
+	if mean != 54.5 || peak != 500 || at != 6 {
+		t.Errorf("got mean %g, peak %g at %d, want 54.5, 500 at 6", mean, peak, at)
+	}
+	if got := NormalizeForce(peak, mean, peak); got != 1 {
+		t.Errorf("the peak force normalizes to %g, want 1", got)
+	}
+	if got := NormalizeForce(5, mean, peak); !(got > 0 && got < 0.1) {
+		t.Errorf("an ordinary force normalizes to %g, want a small positive value", got)
+	}
+
+	particles[2].Force.X = math.NaN()
+	if _, _, at := ForceStats(particles); at != 2 {
+		t.Errorf("NaN force not reported: peak at %d", at)
+	}
+}
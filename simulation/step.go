@@ -0,0 +1,82 @@
+package simulation
+
+import "math"
+
+// StepParams is everything one call to StepWith needs from the caller. The
+// sim's own Dt is not consulted: the caller's clock decides how far to go.
+type StepParams struct {
+	Gravity            float64
+	PressureMultiplier float64
+	Dt                 float64 // total time to advance
+	Substeps           int     // split Dt into this many equal steps; 0 or 1 for one step
+
+	// Optional overrides of the sim's own settings for this call only; nil
+	// keeps the sim's value, and the sim's values are restored on return.
+	Rho0, Nu, MaxSpeed *float64
+}
+
+// StepResult summarizes the state after a StepWith call.
+type StepResult struct {
+	MeanPressure float64
+	StdPressure  float64
+	DensityError float64 // mean |rho - rho0| / rho0
+	Clamped      int     // particle speed clamps summed over the substeps
+	Iterations   int     // most pressure solver iterations any substep took
+}
+
+// StepWith advances the simulation by exactly params.Dt and reports the
+// resulting pressure statistics and density error. Stepping is deterministic:
+// the same state and params always give the same result, so it can be driven
+// from an external clock. OnStep, if set, is called last.
+func (sim *FluidSim) StepWith(params StepParams) StepResult {
+	substeps := params.Substeps
+	if substeps < 1 {
+		substeps = 1
+	}
+	defer override(&sim.Rho0, params.Rho0)()
+	defer override(&sim.Nu, params.Nu)()
+	defer override(&sim.MaxSpeed, params.MaxSpeed)()
+
+	var result StepResult
+	dt := params.Dt / float64(substeps)
+	for s := 0; s < substeps; s++ {
+		sim.Advance(params.Gravity, params.PressureMultiplier, dt)
+		result.Clamped += sim.Clamped
+		if sim.Iterations > result.Iterations {
+			result.Iterations = sim.Iterations
+		}
+	}
+
+	result.MeanPressure, result.StdPressure = sim.CalculatePressureStats()
+	result.DensityError = sim.densityError()
+
+	if sim.OnStep != nil {
+		sim.OnStep(sim.steps, sim.Particles)
+	}
+	sim.steps++
+	return result
+}
+
+// override sets *field to *value, if value is set, and returns a func that
+// puts the old value back.
+func override(field, value *float64) func() {
+	if value == nil {
+		return func() {}
+	}
+	old := *field
+	*field = *value
+	return func() { *field = old }
+}
+
+// densityError is the mean relative deviation of particle density from Rho0,
+// the DensityError of both StepResult and StepStats.
+func (sim *FluidSim) densityError() float64 {
+	n := len(sim.Particles)
+	if n == 0 {
+		return 0
+	}
+	total := sim.parallelReduce(0, n, 0, func(i int) float64 {
+		return math.Abs(sim.Particles[i].Density - sim.Rho0)
+	}, sum)
+	return total / float64(n) / sim.Rho0
+}
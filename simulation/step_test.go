@@ -0,0 +1,88 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestStepWithSubstepsMatchesAdvance(t *testing.T) {
+	rand.Seed(5)
+	a := NewFluidSim(200, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+	rand.Seed(5)
+	b := NewFluidSim(200, Domain{X: 50, Y: 50}, 0.0005, 1, 1)
+
+	result := a.StepWith(StepParams{Gravity: -1000, PressureMultiplier: 10000, Dt: 0.002, Substeps: 4})
+	for s := 0; s < 4; s++ {
+		b.Advance(-1000, 10000, 0.0005)
+	}
+	if pos, vel := Compare(a, b); pos != 0 || vel != 0 {
+		t.Errorf("StepWith diverged from 4 Advance calls: pos %v, vel %v", pos, vel)
+	}
+
+	mean, std := b.CalculatePressureStats()
+	if result.MeanPressure != mean || result.StdPressure != std {
+		t.Errorf("result pressure (%v, %v), want (%v, %v)", result.MeanPressure, result.StdPressure, mean, std)
+	}
+	if want := b.ComputeStepStats(0, mean, std, 0).DensityError; math.Abs(result.DensityError-want) > 1e-12 {
+		t.Errorf("density error %v, want %v", result.DensityError, want)
+	}
+}
+
+func TestStepWithOverridesApplyForOneCall(t *testing.T) {
+	rand.Seed(5)
+	a := NewFluidSim(100, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+	rand.Seed(5)
+	b := NewFluidSim(100, Domain{X: 30, Y: 30}, 0.0005, 1, 1)
+
+	rho0, maxSpeed := 0.5, 20.0
+	result := a.StepWith(StepParams{PressureMultiplier: 10000, Dt: 0.001, Rho0: &rho0, MaxSpeed: &maxSpeed})
+	b.Rho0, b.MaxSpeed = rho0, maxSpeed
+	want := b.StepWith(StepParams{PressureMultiplier: 10000, Dt: 0.001})
+	if pos, vel := Compare(a, b); pos != 0 || vel != 0 {
+		t.Errorf("overridden step diverged from one with the settings changed: pos %v, vel %v", pos, vel)
+	}
+	if result.DensityError != want.DensityError {
+		t.Errorf("density error %v, want %v measured against the overridden Rho0", result.DensityError, want.DensityError)
+	}
+	if a.Rho0 != 1 || a.MaxSpeed != 0 {
+		t.Errorf("overrides outlived the call: Rho0 %v, MaxSpeed %v", a.Rho0, a.MaxSpeed)
+	}
+}
+
+func TestStepWithReportsSolverIterations(t *testing.T) {
+	rand.Seed(5)
+	sim := NewFluidSim(50, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	params := StepParams{PressureMultiplier: 10000, Dt: 0.001, Substeps: 2}
+	if got := sim.StepWith(params).Iterations; got != 1 {
+		t.Errorf("single-pass step reported %d iterations, want 1", got)
+	}
+	sim.DivergenceFree, sim.DivergenceIterations = true, 4
+	if got := sim.StepWith(params).Iterations; got != 5 {
+		t.Errorf("step with a 4-iteration projection reported %d iterations, want 5", got)
+	}
+}
+
+func TestOnStepSeesEveryStep(t *testing.T) {
+	sim := NewFluidSim(20, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	var seen []int
+	sim.OnStep = func(step int, particles []core.Particle) {
+		if len(particles) != 20 {
+			t.Errorf("step %d passed %d particles, want 20", step, len(particles))
+		}
+		seen = append(seen, step)
+	}
+	sim.Step(0, 10000, 0.0005)
+	sim.StepWith(StepParams{PressureMultiplier: 10000, Dt: 0.001, Substeps: 2})
+	sim.Step(0, 10000, 0.0005)
+	if len(seen) != 3 || seen[0] != 0 || seen[1] != 1 || seen[2] != 2 {
+		t.Errorf("OnStep saw steps %v, want [0 1 2]", seen)
+	}
+
+	// trial runs on a clone aren't reported
+	sim.Clone().Step(0, 10000, 0.0005)
+	if len(seen) != 3 {
+		t.Errorf("stepping a clone called the original's OnStep")
+	}
+}
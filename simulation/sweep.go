@@ -0,0 +1,200 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"fluids/spatial"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SweepConfig describes a parameter sweep: Param, one of the SimParameters
+// fields named in sweepParams (case-insensitive), takes Steps evenly spaced
+// values from Min to Max, and every other setting comes from Base. Each run
+// starts from a fresh sim seeded with Seed, so the swept value is the only
+// difference between runs.
+type SweepConfig struct {
+	Param        string
+	Min, Max     float64
+	Steps        int
+	Base         SimParameters
+	N            int
+	Domain       Domain
+	Seed         int64
+	SettledSpeed float64 // IsSettled threshold checked each step; 0 to skip
+
+	// The starting state of every run: particles placed by InitialCondition,
+	// nil to keep NewFluidSim's random placement, then velocities from
+	// VelocityField if set, and periodic boundaries on both axes if Periodic
+	InitialCondition InitialConditionFunc
+	VelocityField    VelocityField
+	Periodic         bool
+}
+
+// SweepResult is the final state of one run of a sweep.
+type SweepResult struct {
+	Value         float64
+	DensityError  float64
+	KineticEnergy float64
+	Settled       bool
+	SettledStep   int // first step IsSettled held, -1 if it never did
+	Err           error
+}
+
+// sweepParams are the parameters a sweep can vary.
+var sweepParams = map[string]func(*SimParameters, float64){
+	"dt":                    func(p *SimParameters, v float64) { p.Dt = v },
+	"rho0":                  func(p *SimParameters, v float64) { p.Rho0 = v },
+	"nu":                    func(p *SimParameters, v float64) { p.Nu = v },
+	"pressuremultiplier":    func(p *SimParameters, v float64) { p.PressureMultiplier = v },
+	"gravity":               func(p *SimParameters, v float64) { p.Gravity = v },
+	"interactionradius":     func(p *SimParameters, v float64) { p.InteractionRadius = v },
+	"densityradius":         func(p *SimParameters, v float64) { p.DensityRadius = v },
+	"radiusvariation":       func(p *SimParameters, v float64) { p.RadiusVariation = v },
+	"restitution":           func(p *SimParameters, v float64) { p.Restitution = v },
+	"maxspeed":              func(p *SimParameters, v float64) { p.MaxSpeed = v },
+	"adhesion":              func(p *SimParameters, v float64) { p.Adhesion = v },
+	"friction":              func(p *SimParameters, v float64) { p.Friction = v },
+	"restpressurethreshold": func(p *SimParameters, v float64) { p.RestPressureThreshold = v },
+	"minparticledistance":   func(p *SimParameters, v float64) { p.MinParticleDistance = v },
+}
+
+// SweepParamNames lists the parameters a sweep can vary.
+func SweepParamNames() []string {
+	names := make([]string, 0, len(sweepParams))
+	for name := range sweepParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values returns the swept values, Min alone when Steps is 1 or less.
+func (cfg SweepConfig) Values() []float64 {
+	if cfg.Steps <= 1 {
+		return []float64{cfg.Min}
+	}
+	values := make([]float64, cfg.Steps)
+	for k := range values {
+		values[k] = cfg.Min + (cfg.Max-cfg.Min)*float64(k)/float64(cfg.Steps-1)
+	}
+	return values
+}
+
+// RunSweep runs stepsPerRun steps for each swept value and records the final
+// density error and kinetic energy, and whether and when the fluid settled. A
+// value that makes the parameters invalid, or an unknown Param, is reported
+// in that result's Err rather than run.
+func RunSweep(cfg SweepConfig, stepsPerRun int) []SweepResult {
+	values := cfg.Values()
+	results := make([]SweepResult, len(values))
+	for k, value := range values {
+		results[k] = SweepResult{Value: value, SettledStep: -1}
+		sim, params, err := cfg.NewSim(value)
+		if err != nil {
+			results[k].Err = err
+			continue
+		}
+		runSweepValue(cfg, sim, params, stepsPerRun, &results[k])
+	}
+	return results
+}
+
+// NewSim builds the sim for one swept value: the base parameters with Param
+// set to value, a fresh sim seeded with Seed and started from the sweep's
+// initial condition and velocity field, relaxed and settled as the
+// parameters ask. It also returns the parameters, for the per-step settings
+// the sim doesn't hold.
+func (cfg SweepConfig) NewSim(value float64) (*FluidSim, SimParameters, error) {
+	set, ok := sweepParams[strings.ToLower(cfg.Param)]
+	if !ok {
+		return nil, SimParameters{}, fmt.Errorf("unknown sweep parameter %q; want one of %s", cfg.Param, strings.Join(SweepParamNames(), ", "))
+	}
+	params := cfg.Base
+	set(&params, value)
+
+	rand.Seed(cfg.Seed)
+	sim, err := NewFluidSimWithParams(cfg.N, cfg.Domain, params)
+	if err != nil {
+		return nil, params, err
+	}
+	if cfg.Periodic {
+		sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	}
+	if cfg.InitialCondition != nil {
+		sim.ApplyInitialCondition(cfg.InitialCondition)
+	}
+	sim.ApplyVelocityField(cfg.VelocityField)
+	sim.RelaxPacking(params.RelaxIterations)
+	sim.Settle(params.SettleSteps, params.PressureMultiplier, params.Dt)
+	return sim, params, nil
+}
+
+func runSweepValue(cfg SweepConfig, sim *FluidSim, params SimParameters, steps int, result *SweepResult) {
+	for step := 0; step < steps; step++ {
+		sim.Step(params.Gravity, params.PressureMultiplier, params.Dt)
+		if cfg.SettledSpeed > 0 && sim.IsSettled(cfg.SettledSpeed) && !result.Settled {
+			result.Settled, result.SettledStep = true, step
+		}
+	}
+	stats := sim.ComputeStepStats(steps, 0, 0, 0)
+	result.DensityError = stats.DensityError
+	result.KineticEnergy = stats.KineticEnergy
+}
+
+var sweepHeader = []string{"value", "density_error", "kinetic_energy", "settled", "settled_step", "error"}
+
+// WriteSweepCSV writes sweep results as CSV, one row per swept value.
+func WriteSweepCSV(w io.Writer, results []SweepResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(sweepHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		record := []string{
+			strconv.FormatFloat(r.Value, 'g', -1, 64),
+			strconv.FormatFloat(r.DensityError, 'g', -1, 64),
+			strconv.FormatFloat(r.KineticEnergy, 'g', -1, 64),
+			strconv.FormatBool(r.Settled),
+			strconv.Itoa(r.SettledStep),
+			errText,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseSweepSpec parses "param=min:max:steps", e.g. "nu=0.5:2:4".
+func ParseSweepSpec(spec string) (SweepConfig, error) {
+	var cfg SweepConfig
+	name, rangeSpec, ok := strings.Cut(spec, "=")
+	parts := strings.Split(rangeSpec, ":")
+	if !ok || name == "" || len(parts) != 3 {
+		return cfg, fmt.Errorf("sweep %q: want param=min:max:steps", spec)
+	}
+	cfg.Param = name
+	var err error
+	if cfg.Min, err = strconv.ParseFloat(parts[0], 64); err != nil {
+		return cfg, fmt.Errorf("sweep %q: %w", spec, err)
+	}
+	if cfg.Max, err = strconv.ParseFloat(parts[1], 64); err != nil {
+		return cfg, fmt.Errorf("sweep %q: %w", spec, err)
+	}
+	if cfg.Steps, err = strconv.Atoi(parts[2]); err != nil {
+		return cfg, fmt.Errorf("sweep %q: %w", spec, err)
+	}
+	if _, known := sweepParams[strings.ToLower(name)]; !known {
+		return cfg, fmt.Errorf("sweep %q: unknown parameter %q; want one of %s", spec, name, strings.Join(SweepParamNames(), ", "))
+	}
+	return cfg, nil
+}
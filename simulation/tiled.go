@@ -0,0 +1,162 @@
+package simulation
+
+import (
+	"fluids/core"
+	"fmt"
+	"sync"
+)
+
+// TiledSim splits the domain into an NX x NY grid of tiles, each stepped by its
+// own FluidSim in parallel. Every tile sim spans the full domain so the outer
+// walls behave exactly as in a single FluidSim; a tile simply owns the
+// particles whose position falls inside its rectangle. Particles within one
+// interaction radius of a tile are copied into it as ghosts before each step so
+// forces are continuous across tile seams, and are discarded afterwards.
+type TiledSim struct {
+	Tiles     []*FluidSim
+	NX, NY    int
+	Domain    Domain
+	Particles []core.Particle // unified view of all owned particles
+
+	owners [][]int // indices into Particles owned by each tile, rebuilt every step
+}
+
+// NewTiledSim splits the domain into nx x ny tiles. Ghosts are only copied
+// from adjacent tiles, so every tile must be at least one interaction radius
+// across; it returns an error for fewer than one tile on an axis or tiles
+// narrower than that.
+func NewTiledSim(n, nx, ny int, domain Domain, dt, rho0, nu float64) (*TiledSim, error) {
+	if nx < 1 || ny < 1 {
+		return nil, fmt.Errorf("tiled sim needs at least one tile on each axis, got %d x %d", nx, ny)
+	}
+	seed := NewFluidSim(n, domain, dt, rho0, nu)
+	w, h := domain.X/float64(nx), domain.Y/float64(ny)
+	if !(w >= seed.InteractionRadius && h >= seed.InteractionRadius) {
+		return nil, fmt.Errorf("%d x %d tiles of %g x %g are narrower than the interaction radius %g", nx, ny, w, h, seed.InteractionRadius)
+	}
+	tiles := make([]*FluidSim, nx*ny)
+	for i := range tiles {
+		tiles[i] = NewFluidSim(0, domain, dt, rho0, nu)
+		tiles[i].tiled = true
+	}
+	return &TiledSim{
+		Tiles:     tiles,
+		NX:        nx,
+		NY:        ny,
+		Domain:    domain,
+		Particles: seed.Particles,
+		owners:    make([][]int, nx*ny),
+	}, nil
+}
+
+func (ts *TiledSim) tileSize() (float64, float64) {
+	return ts.Domain.X / float64(ts.NX), ts.Domain.Y / float64(ts.NY)
+}
+
+// tileCoords returns the tile column and row containing (x, y), clamped so
+// particles sitting on the outer walls still belong to an edge tile.
+func (ts *TiledSim) tileCoords(x, y float64) (int, int) {
+	w, h := ts.tileSize()
+	tx, ty := int(x/w), int(y/h)
+	if tx < 0 {
+		tx = 0
+	} else if tx >= ts.NX {
+		tx = ts.NX - 1
+	}
+	if ty < 0 {
+		ty = 0
+	} else if ty >= ts.NY {
+		ty = ts.NY - 1
+	}
+	return tx, ty
+}
+
+// TileOf returns the index into Tiles of the tile owning position (x, y).
+func (ts *TiledSim) TileOf(x, y float64) int {
+	tx, ty := ts.tileCoords(x, y)
+	return ty*ts.NX + tx
+}
+
+// distribute assigns every particle to its owning tile and copies ghosts from
+// neighboring tiles. Owned particles come first in each tile's slice.
+//
+// A particle's neighbor list is a buffer that FindNeighbors fills and
+// recycles, and the copies in different tiles are stepped concurrently, so
+// no copy keeps the list it arrived with: each takes the buffer of the tile
+// slot it lands in, which only that tile ever touches.
+func (ts *TiledSim) distribute() {
+	for t := range ts.owners {
+		ts.owners[t] = ts.owners[t][:0]
+	}
+	for i, p := range ts.Particles {
+		t := ts.TileOf(p.X, p.Y)
+		ts.owners[t] = append(ts.owners[t], i)
+	}
+
+	w, h := ts.tileSize()
+	for t, tile := range ts.Tiles {
+		tile.Particles = tile.Particles[:0]
+		for _, i := range ts.owners[t] {
+			placeInTile(tile, ts.Particles[i])
+		}
+
+		// ghost region: the tile rectangle grown by one interaction radius
+		tx, ty := t%ts.NX, t/ts.NX
+		halo := tile.InteractionRadius
+		minX, maxX := float64(tx)*w-halo, float64(tx+1)*w+halo
+		minY, maxY := float64(ty)*h-halo, float64(ty+1)*h+halo
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				nx, ny := tx+dx, ty+dy
+				if (dx == 0 && dy == 0) || nx < 0 || ny < 0 || nx >= ts.NX || ny >= ts.NY {
+					continue
+				}
+				for _, i := range ts.owners[ny*ts.NX+nx] {
+					p := ts.Particles[i]
+					if p.X >= minX && p.X < maxX && p.Y >= minY && p.Y < maxY {
+						placeInTile(tile, p)
+					}
+				}
+			}
+		}
+		tile.N = len(tile.Particles)
+	}
+}
+
+// placeInTile appends a copy of p to the tile, giving it the neighbor buffer
+// the tile's previous particle in that slot had rather than p's own.
+func placeInTile(tile *FluidSim, p core.Particle) {
+	k := len(tile.Particles)
+	p.Neighbors = nil
+	if k < cap(tile.Particles) {
+		p.Neighbors = tile.Particles[:k+1][k].Neighbors[:0]
+	}
+	tile.Particles = append(tile.Particles, p)
+}
+
+// Step advances every tile by one step in parallel, then gathers the owned
+// particles back into the unified view. Particles that crossed a tile seam are
+// picked up by their new tile on the next call. Particles with a finite
+// lifetime are aged, and the expired ones removed, once gathered.
+func (ts *TiledSim) Step(gravity, pressureMultiplier, dt float64) (float64, float64) {
+	ts.distribute()
+
+	var wg sync.WaitGroup
+	for _, tile := range ts.Tiles {
+		wg.Add(1)
+		go func(tile *FluidSim) {
+			defer wg.Done()
+			tile.Step(gravity, pressureMultiplier, dt)
+		}(tile)
+	}
+	wg.Wait()
+
+	for t, tile := range ts.Tiles {
+		for k, i := range ts.owners[t] {
+			ts.Particles[i] = tile.Particles[k]
+		}
+	}
+	ts.Particles = ageParticles(ts.Particles, dt)
+
+	return pressureStats(ts.Tiles[0].parallel(), ts.Particles)
+}
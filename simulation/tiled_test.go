@@ -0,0 +1,91 @@
+package simulation
+
+import (
+	"fluids/core"
+	"testing"
+)
+
+func TestTiledSimMigratesAcrossSeam(t *testing.T) {
+	domain := Domain{X: 100, Y: 100}
+	ts, err := NewTiledSim(0, 2, 1, domain, 0.01, 1.0, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Particles = []core.Particle{
+		{X: 48, Y: 50, Vx: 50},  // heading right across the seam at x=50
+		{X: 20, Y: 50},          // deep inside the left tile
+		{X: 51, Y: 20, Vx: -50}, // heading left across the seam
+	}
+
+	if got := ts.TileOf(ts.Particles[0].X, ts.Particles[0].Y); got != 0 {
+		t.Fatalf("particle 0 starts in tile %d, want 0", got)
+	}
+
+	ts.distribute()
+	// particle 2 sits within one radius of the seam, so the left tile sees it as a ghost
+	if got := len(ts.Tiles[0].Particles); got != 3 {
+		t.Errorf("left tile holds %d particles with ghosts, want 3", got)
+	}
+
+	for step := 0; step < 10; step++ {
+		ts.Step(0, 0, ts.Tiles[0].Dt)
+	}
+
+	if len(ts.Particles) != 3 {
+		t.Fatalf("particle count changed to %d", len(ts.Particles))
+	}
+	if got := ts.TileOf(ts.Particles[0].X, ts.Particles[0].Y); got != 1 {
+		t.Errorf("particle 0 at x=%v owned by tile %d, want 1", ts.Particles[0].X, got)
+	}
+	if got := ts.TileOf(ts.Particles[2].X, ts.Particles[2].Y); got != 0 {
+		t.Errorf("particle 2 at x=%v owned by tile %d, want 0", ts.Particles[2].X, got)
+	}
+
+	ts.distribute()
+	owned := len(ts.owners[0]) + len(ts.owners[1])
+	if owned != 3 {
+		t.Errorf("tiles own %d particles in total, want 3", owned)
+	}
+}
+
+func TestTiledSimExpiresParticles(t *testing.T) {
+	ts, err := NewTiledSim(200, 2, 2, Domain{X: 60, Y: 60}, 0.0005, 1.0, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ts.Particles {
+		if i%2 == 1 {
+			ts.Particles[i].MaxAge = 0.001
+		}
+	}
+
+	for step := 0; step < 4; step++ {
+		ts.Step(0, 1000, 0.0005)
+	}
+
+	if len(ts.Particles) != 100 {
+		t.Fatalf("%d particles after the short-lived half expired, want 100", len(ts.Particles))
+	}
+	seen := map[int]bool{}
+	for _, p := range ts.Particles {
+		if p.MaxAge != 0 {
+			t.Errorf("particle %d outlived its lifetime", p.ID)
+		}
+		if seen[p.ID] {
+			t.Errorf("particle %d gathered twice", p.ID)
+		}
+		seen[p.ID] = true
+	}
+}
+
+func TestNewTiledSimRejectsBadTiles(t *testing.T) {
+	domain := Domain{X: 100, Y: 100}
+	for _, tiles := range [][2]int{{0, 2}, {2, 0}, {-1, 1}, {50, 1}, {1, 30}} {
+		if _, err := NewTiledSim(10, tiles[0], tiles[1], domain, 0.0005, 1, 1); err == nil {
+			t.Errorf("%d x %d tiles accepted", tiles[0], tiles[1])
+		}
+	}
+	if _, err := NewTiledSim(10, 25, 25, domain, 0.0005, 1, 1); err != nil {
+		t.Errorf("tiles one interaction radius across rejected: %v", err)
+	}
+}
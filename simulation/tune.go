@@ -0,0 +1,118 @@
+package simulation
+
+import (
+	"fluids/core"
+	"math"
+)
+
+// Clone returns an independent copy of the simulation: particles, grid,
+// piston, and tunnel are all duplicated, so stepping the copy leaves the
+// original untouched. The copy has no OnStep, so trial runs on it aren't
+// reported as the original's steps.
+func (sim *FluidSim) Clone() *FluidSim {
+	c := *sim
+	c.Particles = make([]core.Particle, len(sim.Particles))
+	copy(c.Particles, sim.Particles)
+	for i := range c.Particles {
+		c.Particles[i].Neighbors = make([]core.Particle, 0, cap(sim.Particles[i].Neighbors))
+	}
+	c.candidates, c.spareNeighbors, c.shifts, c.inRange, c.nextParticles = nil, nil, nil, nil, nil
+	c.OnStep = nil
+	c.impacts, c.Splashes = nil, nil
+	c.cache = neighborCache{}
+	c.SetGridType(sim.GridType)
+	if sim.Piston != nil {
+		piston := *sim.Piston
+		c.Piston = &piston
+	}
+	if sim.Tunnel != nil {
+		tunnel := *sim.Tunnel
+		if tunnel.Obstacle != nil {
+			obstacle := *tunnel.Obstacle
+			tunnel.Obstacle = &obstacle
+		}
+		c.Tunnel = &tunnel
+	}
+	return &c
+}
+
+// AutoTuneDt is AutoTuneDtWith for a weightless fluid at the default
+// pressure multiplier.
+func (sim *FluidSim) AutoTuneDt(targetDensityError float64) float64 {
+	return sim.AutoTuneDtWith(StepParams{PressureMultiplier: GetDefaultSimParameters().PressureMultiplier}, targetDensityError)
+}
+
+// trial steps per candidate time step
+const autoTuneSteps = 10
+
+// a stable candidate moves no particle further than this fraction of the
+// interaction radius in one step
+const autoTuneCFL = 0.4
+
+// the recommendation is this fraction of the largest stable candidate
+const autoTuneSafety = 0.5
+
+// bounds on how far the search moves from the starting Dt, in factors of 2
+const (
+	autoTuneMaxDoublings = 6
+	autoTuneMaxHalvings  = 20
+)
+
+// AutoTuneDtWith recommends a time step for the current state. Starting from
+// sim.Dt it halves or doubles the step, running autoTuneSteps trial steps at
+// each candidate on a fresh clone, until it finds the largest candidate that
+// stays finite, lets the density error grow by no more than
+// targetDensityError over the trial, and moves no particle more than
+// autoTuneCFL of an interaction radius per step. Growth rather than the error
+// itself is measured because the error of the starting state doesn't depend
+// on the step size. That
+// candidate is scaled by autoTuneSafety. params.Dt is ignored; the sim itself
+// is not modified.
+func (sim *FluidSim) AutoTuneDtWith(params StepParams, targetDensityError float64) float64 {
+	dt := sim.Dt
+	if dt <= 0 {
+		dt = GetDefaultSimParameters().Dt
+	}
+
+	if !sim.stableAt(params, dt, targetDensityError) {
+		for i := 0; i < autoTuneMaxHalvings; i++ {
+			dt /= 2
+			if sim.stableAt(params, dt, targetDensityError) {
+				break
+			}
+		}
+		return dt * autoTuneSafety
+	}
+	for i := 0; i < autoTuneMaxDoublings; i++ {
+		if !sim.stableAt(params, 2*dt, targetDensityError) {
+			break
+		}
+		dt *= 2
+	}
+	return dt * autoTuneSafety
+}
+
+// stableAt runs the trial steps at dt on a clone and reports whether they
+// passed.
+func (sim *FluidSim) stableAt(params StepParams, dt, targetDensityError float64) bool {
+	trial := sim.Clone()
+	params.Dt, params.Substeps = dt, 1
+	baseline := 0.0
+	for s := 0; s < autoTuneSteps; s++ {
+		result := trial.StepWith(params)
+		if s == 0 {
+			baseline = result.DensityError
+		}
+		if math.IsNaN(result.DensityError) || math.IsInf(result.DensityError, 0) || result.DensityError-baseline > targetDensityError {
+			return false
+		}
+		for i := range trial.Particles {
+			p := &trial.Particles[i]
+			speed := math.Hypot(p.Vx, p.Vy)
+			if math.IsNaN(speed) || math.IsInf(speed, 0) || speed*dt > autoTuneCFL*trial.InteractionRadius {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package simulation
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	for _, skin := range []float64{0, 0.25} {
+		rand.Seed(1)
+		sim := NewFluidSim(100, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+		sim.SetNeighborSkin(skin)
+		sim.Step(0, 10000, sim.Dt)
+		sim.Piston = &Piston{Velocity: 10}
+		before := sim.Clone()
+		builtAt := append([]cachedPosition(nil), sim.cache.builtAt...)
+
+		c := sim.Clone()
+		for step := 0; step < 5; step++ {
+			c.Step(-100000, 10000, c.Dt)
+		}
+		if pos, vel := Compare(sim, before); pos != 0 || vel != 0 {
+			t.Errorf("skin %g: stepping the clone moved the original by %v in position, %v in velocity", skin, pos, vel)
+		}
+		if sim.Piston.Y != 0 {
+			t.Errorf("skin %g: stepping the clone moved the original's piston to %v", skin, sim.Piston.Y)
+		}
+		for i := range builtAt {
+			if sim.cache.builtAt[i] != builtAt[i] {
+				t.Fatalf("skin %g: stepping the clone rewrote the original's neighbor cache", skin)
+			}
+		}
+	}
+}
+
+func TestAutoTuneDtIsConservative(t *testing.T) {
+	rand.Seed(1)
+	sim := NewFluidSim(100, Domain{X: 20, Y: 20}, 0.0005, 1, 1)
+	sim.Step(0, 10000, sim.Dt)
+	before := sim.Clone()
+	params := StepParams{Gravity: -100000, PressureMultiplier: 10000}
+
+	loose := sim.AutoTuneDtWith(params, 0.5)
+	tight := sim.AutoTuneDtWith(params, 0.05)
+	if pos, vel := Compare(sim, before); pos != 0 || vel != 0 || sim.Dt != before.Dt {
+		t.Fatal("tuning changed the simulation it measured")
+	}
+	if tight <= 0 || tight > loose {
+		t.Errorf("tighter target recommended %v, want positive and no larger than %v", tight, loose)
+	}
+	if again := sim.AutoTuneDtWith(params, 0.5); again != loose {
+		t.Errorf("second run recommended %v, first %v", again, loose)
+	}
+	// the step the recommendation was scaled down from must pass the trial
+	if !sim.stableAt(params, loose/autoTuneSafety, 0.5) {
+		t.Errorf("recommended %v comes from a step size that fails the trial", loose)
+	}
+}
@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+)
+
+// WindTunnel drives a steady flow along +X. Particles in the inflow band at
+// the left edge are held at Speed, and the right edge is periodic: fluid
+// leaving there is the sink, and it re-enters on the left as the inflow, so
+// the particle count stays fixed. Obstacle, when set, is a solid disc the
+// flow has to go around.
+type WindTunnel struct {
+	Speed       float64
+	InflowWidth float64
+	Obstacle    *Obstacle
+}
+
+// Obstacle is a solid disc centered at (X, Y).
+type Obstacle struct {
+	X, Y, Radius float64
+}
+
+// NewWindTunnelScene returns a sim set up as a wind tunnel: periodic on both
+// axes, with particles placed at random and already moving at the inflow
+// speed. Set Tunnel.Obstacle to watch a wake form behind it.
+func NewWindTunnelScene(n int, domain Domain, dt, rho0, nu, speed float64) *FluidSim {
+	sim := NewFluidSim(n, domain, dt, rho0, nu)
+	sim.LeftBoundary, sim.TopBoundary = spatial.Periodic, spatial.Periodic
+	sim.Tunnel = &WindTunnel{Speed: speed, InflowWidth: sim.InteractionRadius}
+	for i := range sim.Particles {
+		sim.Particles[i].Vx = speed
+	}
+	return sim
+}
+
+// CenterObstacle returns a disc of the given radius in the middle of the domain.
+func (d Domain) CenterObstacle(radius float64) *Obstacle {
+	x, y := d.Center()
+	return &Obstacle{X: x, Y: y, Radius: radius}
+}
+
+// applyTunnel resets the inflow band to the free stream and keeps particles
+// out of the obstacle.
+func (sim *FluidSim) applyTunnel() {
+	tunnel := sim.Tunnel
+	sim.parallelFor(0, len(sim.Particles), func(i int) {
+		p := &sim.Particles[i]
+		if p.X < tunnel.InflowWidth {
+			p.Vx, p.Vy = tunnel.Speed, 0
+		}
+		if tunnel.Obstacle != nil {
+			tunnel.Obstacle.reflect(&p.X, &p.Y, &p.Vx, &p.Vy, sim.Restitution)
+		}
+	})
+}
+
+// reflect moves a point inside the disc out to its surface and bounces the
+// velocity component heading into it, keeping restitution of it. A point at
+// the exact center is sent back upstream.
+func (o *Obstacle) reflect(x, y, vx, vy *float64, restitution float64) {
+	dx, dy := *x-o.X, *y-o.Y
+	r := math.Hypot(dx, dy)
+	if r >= o.Radius {
+		return
+	}
+	nx, ny := -1.0, 0.0
+	if r > 0 {
+		nx, ny = dx/r, dy/r
+	}
+	*x = o.X + nx*(o.Radius+spatial.EPSILON)
+	*y = o.Y + ny*(o.Radius+spatial.EPSILON)
+	if vn := *vx*nx + *vy*ny; vn < 0 {
+		*vx -= (1 + restitution) * vn * nx
+		*vy -= (1 + restitution) * vn * ny
+	}
+}
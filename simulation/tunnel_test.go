@@ -0,0 +1,47 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestObstacleReflectsInwardVelocity(t *testing.T) {
+	o := &Obstacle{X: 10, Y: 10, Radius: 2}
+	x, y, vx, vy := 11.0, 10.0, -4.0, 1.0
+	o.reflect(&x, &y, &vx, &vy, 0.5)
+	if x < 12 || y != 10 {
+		t.Errorf("point left at (%v, %v), want it on the surface at x=12", x, y)
+	}
+	if vx != 2 || vy != 1 {
+		t.Errorf("velocity (%v, %v), want the normal part bounced to 2 and the tangential part kept", vx, vy)
+	}
+}
+
+func TestWindTunnelKeepsFlowing(t *testing.T) {
+	rand.Seed(1)
+	const speed = 20
+	sim := NewWindTunnelScene(100, Domain{X: 30, Y: 15}, 0.0005, 1, 1, speed)
+	sim.Tunnel.Obstacle = sim.Domain.CenterObstacle(3)
+	for step := 0; step < 200; step++ {
+		sim.Advance(0, 100, sim.Dt)
+	}
+
+	if len(sim.Particles) != 100 {
+		t.Fatalf("%d particles, want the 100 the tunnel started with", len(sim.Particles))
+	}
+	meanVx := 0.0
+	o := sim.Tunnel.Obstacle
+	for i, p := range sim.Particles {
+		if math.Hypot(p.X-o.X, p.Y-o.Y) < o.Radius {
+			t.Fatalf("particle %d at (%v, %v) is inside the obstacle", i, p.X, p.Y)
+		}
+		if p.X < sim.Tunnel.InflowWidth && (p.Vx != speed || p.Vy != 0) {
+			t.Fatalf("particle %d in the inflow band moving (%v, %v), want (%v, 0)", i, p.Vx, p.Vy, speed)
+		}
+		meanVx += p.Vx / float64(len(sim.Particles))
+	}
+	if meanVx < speed/2 || meanVx > 1.5*speed {
+		t.Errorf("mean downstream velocity %v drifted far from the inflow speed %v", meanVx, speed)
+	}
+}
@@ -0,0 +1,64 @@
+package simulation
+
+import (
+	"fluids/spatial"
+	"math"
+)
+
+// VelocityField gives the starting velocity at a point, prescribed on top of
+// whatever placed the particles.
+type VelocityField func(x, y float64) (vx, vy float64)
+
+// ApplyVelocityField sets every particle's velocity from the field at its
+// current position, so it composes with any initial condition: place the
+// particles first, then apply the field. A nil field leaves the velocities
+// the initial condition gave.
+func (sim *FluidSim) ApplyVelocityField(field VelocityField) {
+	if field == nil {
+		return
+	}
+	for i := range sim.Particles {
+		p := &sim.Particles[i]
+		p.Vx, p.Vy = field(p.X, p.Y)
+	}
+}
+
+// ShearLayerField is a horizontal shear layer across the middle of the
+// domain: the top half flows right at u0 and the bottom half left, with a
+// tanh profile a twentieth of the domain's height thick between them,
+//
+//	vx = u0 tanh((y - cy) / delta)
+//
+// A small vertical wave, one wavelength across the domain and confined to the
+// layer, seeds the Kelvin-Helmholtz roll-up; it is meant for periodic left and
+// right boundaries.
+func ShearLayerField(domain Domain, u0 float64) VelocityField {
+	_, cy := domain.Center()
+	delta := domain.Y / 20
+	k := 2 * math.Pi / domain.X
+	return func(x, y float64) (float64, float64) {
+		s := (y - cy) / delta
+		return -u0 * math.Tanh(s), 0.05 * u0 * math.Sin(k*x) * math.Exp(-s*s)
+	}
+}
+
+// SingleVortexField is a Rankine vortex at the center of the domain whose core
+// radius is a quarter of the smaller side: inside the core the fluid turns
+// as a solid body, speeding up to u0 at its edge, and outside the speed falls
+// off as 1/r. Positive u0 turns clockwise on screen, where y points down.
+func SingleVortexField(domain Domain, u0 float64) VelocityField {
+	cx, cy := domain.Center()
+	coreRadius := math.Min(domain.X, domain.Y) / 4
+	return func(x, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		r := math.Hypot(dx, dy)
+		if r < spatial.EPSILON {
+			return 0, 0
+		}
+		speed := u0 * r / coreRadius
+		if r > coreRadius {
+			speed = u0 * coreRadius / r
+		}
+		return -dy / r * speed, dx / r * speed
+	}
+}
@@ -0,0 +1,56 @@
+package simulation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApplyVelocityFieldKeepsPositions(t *testing.T) {
+	domain := Domain{X: 40, Y: 20}
+	sim := NewFluidSim(50, domain, 0.0005, 1, 1)
+	sim.ApplyInitialCondition(DamBreakInitialCondition(domain, 50, 0))
+	x7, y7 := sim.Particles[7].X, sim.Particles[7].Y
+
+	sim.ApplyVelocityField(nil)
+	if p := sim.Particles[7]; p.Vx != 0 || p.Vy != 0 {
+		t.Fatalf("nil field moved particle 7 to velocity (%v, %v)", p.Vx, p.Vy)
+	}
+
+	sim.ApplyVelocityField(func(x, y float64) (float64, float64) { return x, -y })
+	for i, p := range sim.Particles {
+		if p.Vx != p.X || p.Vy != -p.Y {
+			t.Fatalf("particle %d at (%v, %v) has velocity (%v, %v), want the field there", i, p.X, p.Y, p.Vx, p.Vy)
+		}
+	}
+	if p := sim.Particles[7]; p.X != x7 || p.Y != y7 {
+		t.Errorf("applying a field moved particle 7 from (%v, %v) to (%v, %v)", x7, y7, p.X, p.Y)
+	}
+}
+
+func TestShearLayerField(t *testing.T) {
+	field := ShearLayerField(Domain{X: 40, Y: 40}, 3)
+	if vx, _ := field(10, 0); math.Abs(vx-3) > 1e-6 {
+		t.Errorf("top flows at %v, want 3", vx)
+	}
+	if vx, _ := field(10, 40); math.Abs(vx+3) > 1e-6 {
+		t.Errorf("bottom flows at %v, want -3", vx)
+	}
+	if vx, _ := field(10, 20); vx != 0 {
+		t.Errorf("middle of the layer flows at %v, want 0", vx)
+	}
+}
+
+func TestSingleVortexField(t *testing.T) {
+	field := SingleVortexField(Domain{X: 40, Y: 40}, 2)
+	// the core radius is 10, centered at (20, 20)
+	for _, r := range []float64{0, 5, 10, 20} {
+		vx, vy := field(20+r, 20)
+		want := 2 * r / 10
+		if r > 10 {
+			want = 2 * 10 / r
+		}
+		if math.Abs(vx) > 1e-12 || math.Abs(vy-want) > 1e-12 {
+			t.Errorf("at radius %v: velocity (%v, %v), want (0, %v)", r, vx, vy, want)
+		}
+	}
+}
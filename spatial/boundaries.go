@@ -26,16 +26,42 @@ const (
 	Periodic
 )
 
-func HandleBoundary(position *float64, velocity *float64, limit float64, boundaryType BoundaryType) {
+// HandleBoundary reflects off the walls at 0 and limit, keeping
+// DAMPENING_FACTOR of the normal velocity, and returns the impact speed as
+// HandleBoundaryWithRestitution does.
+func HandleBoundary(position *float64, velocity *float64, limit float64, boundaryType BoundaryType) float64 {
+	return HandleBoundaryWithRestitution(position, velocity, limit, boundaryType, DAMPENING_FACTOR)
+}
+
+// HandleBoundaryWithRestitution reflects off the walls at 0 and limit, keeping
+// the given fraction of the normal velocity. A restitution of 1 is elastic:
+// speed, and so kinetic energy, is unchanged by the bounce. Periodic
+// boundaries instead wrap the position into [0, limit). The return value is
+// the speed the particle hit a wall at, 0 if it didn't, so callers can react
+// to hard impacts.
+func HandleBoundaryWithRestitution(position *float64, velocity *float64, limit float64, boundaryType BoundaryType, restitution float64) float64 {
+	if boundaryType == Periodic {
+		if *position < 0 || *position >= limit {
+			*position = Fmod(*position, limit)
+			if *position >= limit { // a tiny negative position rounds up to limit
+				*position = 0
+			}
+		}
+		return 0
+	}
+	impact := 0.0
 	if *position >= limit {
 		if boundaryType == Reflective {
 			*position = limit - EPSILON
-			*velocity *= -DAMPENING_FACTOR
+			impact = math.Abs(*velocity)
+			*velocity *= -restitution
 		}
 	} else if *position <= 0 {
 		if boundaryType == Reflective {
 			*position = EPSILON
-			*velocity *= -DAMPENING_FACTOR
+			impact = math.Abs(*velocity)
+			*velocity *= -restitution
 		}
 	}
+	return impact
 }
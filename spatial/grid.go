@@ -2,37 +2,150 @@ package spatial
 
 import (
 	"fluids/core"
-	"fmt"
+	"math"
 )
 
 type Cell struct {
 	Particles []int // Indices of particles in this cell
 }
 
+// CellIndex packs signed cell coordinates into a single map key.
+type CellIndex int64
+
+// MakeCellIndex packs x into the high 32 bits and y into the low 32 bits.
+// y is converted through uint32 so a negative y doesn't sign-extend over x.
+func MakeCellIndex(x, y int) CellIndex {
+	return CellIndex(int64(int32(x))<<32 | int64(uint32(int32(y))))
+}
+
+// CellCoords returns the cell containing (x, y). Floor (rather than truncation)
+// keeps negative positions out of cell 0.
+func CellCoords(x, y, cellSize float64) (int, int) {
+	return int(math.Floor(x / cellSize)), int(math.Floor(y / cellSize))
+}
+
+type GridType int
+
+const (
+	MapGrid GridType = iota
+	HashGridType
+)
+
+// NeighborGrid is the spatial index used for neighbor search.
+type NeighborGrid interface {
+	// Update rebuilds the index from the current particle positions
+	Update(particles []core.Particle)
+	// GetNeighborParticles appends to dst the indices of all particles in the
+	// 3x3 block of cells around (x, y)
+	GetNeighborParticles(x, y float64, dst []int) []int
+	// GetCellParticles appends to dst the indices of the particles in the
+	// cell containing (x, y) alone
+	GetCellParticles(x, y float64, dst []int) []int
+	// CellOf returns the coordinates of the cell (x, y) is filed under
+	CellOf(x, y float64) (int, int)
+	GetCellSize() float64
+	// Resize changes the cell size, emptying the index until the next Update
+	Resize(cellSize float64)
+}
+
+func NewNeighborGrid(gridType GridType, cellSize float64, domainX, domainY int) NeighborGrid {
+	if gridType == HashGridType {
+		return NewHashGrid(cellSize)
+	}
+	grid := NewGrid(cellSize, domainX, domainY)
+	grid.ClampToDomain = true
+	return grid
+}
+
 type Grid struct {
-	CellMap              map[string][]int // Map from cell key to particle indices
+	CellMap              map[CellIndex][]int // Map from cell index to particle indices
 	CellSize             float64
-	NumCellsX, NumCellsY int
+	NumCellsX, NumCellsY int // cells needed to cover the domain
+
+	// ClampToDomain files particles outside the domain under the nearest
+	// edge cell, and clamps queries the same way, so an escaped particle
+	// still meets the particles near where it left and can't spread the
+	// map over far-off cells.
+	ClampToDomain bool
+	Escaped       int // particles outside the domain at the last Update, when clamping
+
+	domainX, domainY int
 }
 
 func NewGrid(cellSize float64, domainX, domainY int) *Grid {
-	return &Grid{
-		CellMap:   make(map[string][]int),
-		CellSize:  cellSize,
-		NumCellsX: int(float64(domainX) / cellSize),
-		NumCellsY: int(float64(domainY) / cellSize),
+	g := &Grid{domainX: domainX, domainY: domainY}
+	g.Resize(cellSize)
+	return g
+}
+
+// Resize changes the cell size and the number of cells covering the domain.
+func (g *Grid) Resize(cellSize float64) {
+	g.CellMap = make(map[CellIndex][]int)
+	g.CellSize = cellSize
+	g.NumCellsX = int(math.Ceil(float64(g.domainX) / cellSize))
+	g.NumCellsY = int(math.Ceil(float64(g.domainY) / cellSize))
+	g.Escaped = 0
+}
+
+// cellOf returns the cell for (x, y), clamped into the domain when
+// ClampToDomain is set, and whether it had to be clamped.
+func (g *Grid) cellOf(x, y float64) (int, int, bool) {
+	i, j := CellCoords(x, y, g.CellSize)
+	if !g.ClampToDomain {
+		return i, j, false
+	}
+	ci := clampCell(i, g.NumCellsX)
+	cj := clampCell(j, g.NumCellsY)
+	return ci, cj, ci != i || cj != j
+}
+
+func clampCell(c, n int) int {
+	if c >= n {
+		c = n - 1
 	}
+	if c < 0 {
+		c = 0
+	}
+	return c
 }
 
 // Update populates the grid cells with particle indices
 func (g *Grid) Update(particles []core.Particle) {
-	g.CellMap = make(map[string][]int) // Clear existing cells
+	g.CellMap = make(map[CellIndex][]int) // Clear existing cells
 
+	g.Escaped = 0
 	for idx, p := range particles {
-		i := int(p.X / g.CellSize)
-		j := int(p.Y / g.CellSize)
-		key := fmt.Sprintf("%d-%d", i, j) // Generate cell key
+		i, j, clamped := g.cellOf(p.X, p.Y)
+		if clamped {
+			g.Escaped++
+		}
+		key := MakeCellIndex(i, j)
 
 		g.CellMap[key] = append(g.CellMap[key], idx)
 	}
 }
+
+func (g *Grid) GetNeighborParticles(x, y float64, dst []int) []int {
+	cellX, cellY, _ := g.cellOf(x, y)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			dst = append(dst, g.CellMap[MakeCellIndex(cellX+dx, cellY+dy)]...)
+		}
+	}
+	return dst
+}
+
+func (g *Grid) GetCellParticles(x, y float64, dst []int) []int {
+	cellX, cellY, _ := g.cellOf(x, y)
+	return append(dst, g.CellMap[MakeCellIndex(cellX, cellY)]...)
+}
+
+// CellOf returns the cell for (x, y), clamped like Update and the queries.
+func (g *Grid) CellOf(x, y float64) (int, int) {
+	i, j, _ := g.cellOf(x, y)
+	return i, j
+}
+
+func (g *Grid) GetCellSize() float64 {
+	return g.CellSize
+}
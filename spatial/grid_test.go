@@ -0,0 +1,188 @@
+package spatial
+
+import (
+	"fluids/core"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMakeCellIndexNegative(t *testing.T) {
+	seen := map[CellIndex][2]int{}
+	for x := -3; x <= 3; x++ {
+		for y := -3; y <= 3; y++ {
+			key := MakeCellIndex(x, y)
+			if prev, ok := seen[key]; ok {
+				t.Fatalf("cells %v and %v share index %d", prev, [2]int{x, y}, key)
+			}
+			seen[key] = [2]int{x, y}
+		}
+	}
+}
+
+func TestHashGridMatchesMapGrid(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	particles := make([]core.Particle, 2000)
+	for i := range particles {
+		// sparse and straddling the origin
+		particles[i].X = rng.Float64()*400 - 200
+		particles[i].Y = rng.Float64()*400 - 200
+	}
+
+	mapGrid := NewGrid(SMOOTHING_RADIUS, 400, 400)
+	hashGrid := NewHashGrid(SMOOTHING_RADIUS)
+	mapGrid.Update(particles)
+	hashGrid.Update(particles)
+
+	for i := 0; i < 500; i++ {
+		x, y := rng.Float64()*420-210, rng.Float64()*420-210
+		want := mapGrid.GetNeighborParticles(x, y, nil)
+		got := hashGrid.GetNeighborParticles(x, y, nil)
+		sort.Ints(want)
+		sort.Ints(got)
+		if len(got) != len(want) {
+			t.Fatalf("query (%v, %v): hash grid found %d candidates, map grid %d", x, y, len(got), len(want))
+		}
+		for k := range want {
+			if got[k] != want[k] {
+				t.Fatalf("query (%v, %v): candidates differ: %v vs %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestGridNegativeCoordinatesFindNeighbors(t *testing.T) {
+	// two particles on either side of the origin, closer than one cell
+	particles := []core.Particle{{X: -0.5, Y: -0.5}, {X: 0.5, Y: 0.5}, {X: -9, Y: 3}}
+	for _, g := range []NeighborGrid{NewGrid(1, 10, 10), NewHashGrid(1)} {
+		g.Update(particles)
+		got := g.GetNeighborParticles(-0.5, -0.5, nil)
+		sort.Ints(got)
+		if len(got) != 2 || got[0] != 0 || got[1] != 1 {
+			t.Errorf("%T: neighbors of (-0.5, -0.5) = %v, want [0 1]", g, got)
+		}
+	}
+}
+
+// Update files each particle under the cell CellCoords gives for its position,
+// which for in-domain positions is int(x/cellSize), int(y/cellSize); neighbor
+// search and the debug overlays both rely on that.
+func TestGridUpdateAssignsCells(t *testing.T) {
+	const cellSize = 4.0
+	particles := []core.Particle{
+		{X: 0, Y: 0},
+		{X: 3.99, Y: 4},
+		{X: 4, Y: 3.99},
+		{X: 17.5, Y: 9.25},
+		{X: 99.9, Y: 0.1},
+	}
+	g := NewGrid(cellSize, 100, 100)
+	g.Update(particles)
+
+	for idx, p := range particles {
+		cellX, cellY := CellCoords(p.X, p.Y, cellSize)
+		if cellX != int(p.X/cellSize) || cellY != int(p.Y/cellSize) {
+			t.Errorf("particle %d at (%v, %v): cell (%d, %d), want (%d, %d)",
+				idx, p.X, p.Y, cellX, cellY, int(p.X/cellSize), int(p.Y/cellSize))
+		}
+		found := false
+		for _, i := range g.CellMap[MakeCellIndex(cellX, cellY)] {
+			found = found || i == idx
+		}
+		if !found {
+			t.Errorf("particle %d missing from cell (%d, %d)", idx, cellX, cellY)
+		}
+	}
+
+	total := 0
+	for _, indices := range g.CellMap {
+		total += len(indices)
+	}
+	if total != len(particles) {
+		t.Errorf("grid holds %d entries, want %d", total, len(particles))
+	}
+}
+
+func TestClampedGridFilesEscapedParticlesAtTheEdge(t *testing.T) {
+	grid := NewNeighborGrid(MapGrid, 2, 20, 20).(*Grid)
+	particles := []core.Particle{
+		{X: 0.5, Y: 5},
+		{X: -50, Y: 5},  // far off the left edge
+		{X: 5, Y: 1e12}, // far below the bottom
+		{X: 19.9, Y: 19.9},
+	}
+	grid.Update(particles)
+
+	if grid.Escaped != 2 {
+		t.Errorf("Escaped = %d, want 2", grid.Escaped)
+	}
+	for key := range grid.CellMap {
+		i, j := int(int32(key>>32)), int(int32(key))
+		if i < 0 || i >= grid.NumCellsX || j < 0 || j >= grid.NumCellsY {
+			t.Errorf("cell (%d, %d) lies outside the %dx%d grid", i, j, grid.NumCellsX, grid.NumCellsY)
+		}
+	}
+
+	near := grid.GetNeighborParticles(0.5, 5, nil)
+	sort.Ints(near)
+	if len(near) != 2 || near[0] != 0 || near[1] != 1 {
+		t.Errorf("query at the left edge found %v, want the edge particle and the one that escaped past it", near)
+	}
+	// the escaped particle's own query lands back at the edge
+	if got := grid.GetNeighborParticles(-50, 5, nil); len(got) != 2 {
+		t.Errorf("query from the escaped particle found %v, want both particles at the left edge", got)
+	}
+	// the domain's far corner is still its own cell, not clamped away
+	if got := grid.GetNeighborParticles(19.9, 19.9, nil); len(got) != 1 || got[0] != 3 {
+		t.Errorf("query at the far corner found %v, want only particle 3", got)
+	}
+	if i, j := grid.CellOf(-50, 5); i != 0 || j != 2 {
+		t.Errorf("escaped particle filed under cell (%d, %d), want the edge cell (0, 2)", i, j)
+	}
+}
+
+func TestResizeMatchesFreshGrid(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	particles := make([]core.Particle, 500)
+	for i := range particles {
+		particles[i].X = rng.Float64() * 40
+		particles[i].Y = rng.Float64() * 40
+	}
+
+	for _, g := range []NeighborGrid{NewNeighborGrid(MapGrid, 2, 40, 40), NewHashGrid(2)} {
+		g.Update(particles)
+		g.Resize(5)
+		g.Update(particles)
+		fresh := NewNeighborGrid(MapGrid, 5, 40, 40)
+		fresh.Update(particles)
+
+		if g.GetCellSize() != 5 {
+			t.Errorf("%T cell size %g after Resize(5)", g, g.GetCellSize())
+		}
+		for i := 0; i < 100; i++ {
+			x, y := rng.Float64()*40, rng.Float64()*40
+			got := g.GetNeighborParticles(x, y, nil)
+			want := fresh.GetNeighborParticles(x, y, nil)
+			sort.Ints(got)
+			sort.Ints(want)
+			if len(got) != len(want) {
+				t.Fatalf("%T: query at (%.1f, %.1f) found %d particles after resizing, a fresh grid finds %d", g, x, y, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestGetCellParticlesReturnsOneCell(t *testing.T) {
+	particles := []core.Particle{{X: 1, Y: 1}, {X: 3, Y: 3.5}, {X: 4.5, Y: 1}, {X: 30, Y: 30}}
+	for _, g := range []NeighborGrid{NewNeighborGrid(MapGrid, 4, 40, 40), NewHashGrid(4)} {
+		g.Update(particles)
+		got := g.GetCellParticles(2, 2, nil)
+		sort.Ints(got)
+		if len(got) != 2 || got[0] != 0 || got[1] != 1 {
+			t.Errorf("%T: cell at (2, 2) holds %v, want [0 1]", g, got)
+		}
+		if got := g.GetCellParticles(20, 20, nil); len(got) != 0 {
+			t.Errorf("%T: empty cell holds %v", g, got)
+		}
+	}
+}
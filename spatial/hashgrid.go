@@ -0,0 +1,105 @@
+package spatial
+
+import "fluids/core"
+
+// HashGrid buckets particles by cell in an open-addressing hash table. Only
+// occupied cells take space, so it suits sparse or unbounded domains, and
+// buckets are reused between updates instead of reallocated.
+type HashGrid struct {
+	CellSize float64
+	keys     []CellIndex
+	used     []bool
+	buckets  [][]int
+	count    int // occupied slots
+}
+
+func NewHashGrid(cellSize float64) *HashGrid {
+	g := &HashGrid{CellSize: cellSize}
+	g.resize(64)
+	return g
+}
+
+func (g *HashGrid) resize(size int) {
+	g.keys = make([]CellIndex, size)
+	g.used = make([]bool, size)
+	g.buckets = make([][]int, size)
+	g.count = 0
+}
+
+func hashCell(key CellIndex) uint64 {
+	// fibonacci hashing spreads neighboring cells across the table
+	return uint64(key) * 0x9E3779B97F4A7C15
+}
+
+// slot returns the table slot holding key, or the empty slot where it belongs.
+func (g *HashGrid) slot(key CellIndex) int {
+	mask := uint64(len(g.keys) - 1)
+	i := hashCell(key) >> 32 & mask
+	for g.used[i] && g.keys[i] != key {
+		i = (i + 1) & mask
+	}
+	return int(i)
+}
+
+func (g *HashGrid) Update(particles []core.Particle) {
+	// every particle may land in its own cell; keep the load factor under 1/2
+	size := len(g.keys)
+	for size < 2*len(particles) {
+		size *= 2
+	}
+	if size != len(g.keys) {
+		g.resize(size)
+	} else {
+		for i := range g.used {
+			g.used[i] = false
+			g.buckets[i] = g.buckets[i][:0]
+		}
+		g.count = 0
+	}
+
+	for idx, p := range particles {
+		x, y := CellCoords(p.X, p.Y, g.CellSize)
+		key := MakeCellIndex(x, y)
+		s := g.slot(key)
+		if !g.used[s] {
+			g.used[s] = true
+			g.keys[s] = key
+			g.count++
+		}
+		g.buckets[s] = append(g.buckets[s], idx)
+	}
+}
+
+func (g *HashGrid) GetNeighborParticles(x, y float64, dst []int) []int {
+	cellX, cellY := CellCoords(x, y, g.CellSize)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			s := g.slot(MakeCellIndex(cellX+dx, cellY+dy))
+			if g.used[s] {
+				dst = append(dst, g.buckets[s]...)
+			}
+		}
+	}
+	return dst
+}
+
+func (g *HashGrid) GetCellParticles(x, y float64, dst []int) []int {
+	cellX, cellY := CellCoords(x, y, g.CellSize)
+	if s := g.slot(MakeCellIndex(cellX, cellY)); g.used[s] {
+		dst = append(dst, g.buckets[s]...)
+	}
+	return dst
+}
+
+func (g *HashGrid) CellOf(x, y float64) (int, int) {
+	return CellCoords(x, y, g.CellSize)
+}
+
+func (g *HashGrid) GetCellSize() float64 {
+	return g.CellSize
+}
+
+func (g *HashGrid) Resize(cellSize float64) {
+	g.CellSize = cellSize
+	g.resize(len(g.keys))
+}
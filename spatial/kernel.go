@@ -7,36 +7,43 @@ import (
 
 const SMOOTHING_RADIUS = 4.0
 
+// SmoothingKernel is the 2D kernel W(r) = (h - r)^2 / V with support radius h.
+// V = pi * h^4 / 6 is the integral of (h - r)^2 over the disc of radius h,
+// so the kernel integrates to 1 over its support.
 func SmoothingKernel(radius, distance float64) float64 {
 	// thank you mr. sebastian lague - https://www.youtube.com/watch?v=rSKMYc1CQHE
 
 	if distance >= radius {
 		return 0
 	}
-	volume := (math.Pi + math.Pow(radius, 4)) / 6
+	volume := math.Pi * math.Pow(radius, 4) / 6
 	return (radius - distance) * (radius - distance) / volume
 }
 
+// SmoothingKernelDerivative is dW/dr of SmoothingKernel: -2 * (h - r) / V.
 func SmoothingKernelDerivative(radius, distance float64) float64 {
 	if distance >= radius {
 		return 0
 	}
-	scale := 12 / (math.Pow(math.Pi, 4) * math.Pi)
+	scale := 12 / (math.Pi * math.Pow(radius, 4))
 	return (distance - radius) * scale
 }
 
-func CalculateDensity(point core.Particle) float64 {
+// CalculateDensity sums the mass-weighted kernel over a particle's neighbors
+// (itself included), so a uniform packing of unit-mass particles with spacing s
+// has density ~1/s^2 independent of the support radius.
+func CalculateDensity(point core.Particle, radius float64) float64 {
 	density := 0.0
 
 	for _, neighbor := range point.Neighbors {
 		distance := core.CalculateDistance(point, neighbor)
-		influence := SmoothingKernel(SMOOTHING_RADIUS, distance)
-		density += 1 * influence
+		influence := SmoothingKernel(radius, distance)
+		density += neighbor.Mass * influence
 	}
 
 	return density
 }
-func SmoothingKernelGradient(point core.Particle) core.Vector {
+func SmoothingKernelGradient(point core.Particle, radius float64) core.Vector {
 	gradW := core.Vector{}
 	for _, neighbor := range point.Neighbors {
 		distance := core.CalculateDistance(point, neighbor)
@@ -44,18 +51,18 @@ func SmoothingKernelGradient(point core.Particle) core.Vector {
 			X: neighbor.X - point.X,
 			Y: neighbor.Y - point.Y,
 		}
-		dir.Multiply(SmoothingKernelDerivative(SMOOTHING_RADIUS, distance))
+		dir.Multiply(SmoothingKernelDerivative(radius, distance))
 		gradW.Add(&dir)
 	}
 	return gradW
 }
 
-func SmoothingKernelLaplacian(point core.Particle) float64 {
+func SmoothingKernelLaplacian(point core.Particle, radius float64) float64 {
 	laplacian := 0.0
 
 	for _, neighbor := range point.Neighbors {
 		distance := core.CalculateDistance(point, neighbor)
-		laplacian += SmoothingKernelDerivative(SMOOTHING_RADIUS, distance)
+		laplacian += SmoothingKernelDerivative(radius, distance)
 	}
 
 	return laplacian
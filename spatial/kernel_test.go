@@ -0,0 +1,63 @@
+package spatial
+
+import (
+	"math"
+	"testing"
+)
+
+// integrateKernel sums f(r) over a fine square grid clipped to the disc of radius h.
+func integrateKernel(h float64, f func(r float64) float64) float64 {
+	const steps = 800
+	cell := 2 * h / steps
+	sum := 0.0
+	for i := 0; i < steps; i++ {
+		x := -h + (float64(i)+0.5)*cell
+		for j := 0; j < steps; j++ {
+			y := -h + (float64(j)+0.5)*cell
+			r := math.Sqrt(x*x + y*y)
+			if r < h {
+				sum += f(r) * cell * cell
+			}
+		}
+	}
+	return sum
+}
+
+func TestSmoothingKernelIntegratesToOne(t *testing.T) {
+	for _, h := range []float64{1, SMOOTHING_RADIUS, 10} {
+		got := integrateKernel(h, func(r float64) float64 { return SmoothingKernel(h, r) })
+		if math.Abs(got-1) > 1e-3 {
+			t.Errorf("h=%v: kernel integrates to %v, want 1", h, got)
+		}
+	}
+}
+
+func TestSmoothingKernelDerivative(t *testing.T) {
+	for _, h := range []float64{1, SMOOTHING_RADIUS, 10} {
+		if d := SmoothingKernelDerivative(h, h); d != 0 {
+			t.Errorf("h=%v: derivative at support edge is %v, want 0", h, d)
+		}
+
+		// the kernel is monotonically decreasing, and the derivative must
+		// agree with a central finite difference of the kernel itself
+		const step = 1e-6
+		for _, frac := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+			r := frac * h
+			d := SmoothingKernelDerivative(h, r)
+			if d >= 0 {
+				t.Errorf("h=%v r=%v: derivative %v should be negative", h, r, d)
+			}
+			fd := (SmoothingKernel(h, r+step) - SmoothingKernel(h, r-step)) / (2 * step)
+			if math.Abs(d-fd) > 1e-6*math.Max(1, math.Abs(fd)) {
+				t.Errorf("h=%v r=%v: derivative %v, finite difference %v", h, r, d, fd)
+			}
+		}
+
+		// over the disc, dW/dr integrates to -24/h^4 * h^3/6 = -4/h
+		got := integrateKernel(h, func(r float64) float64 { return SmoothingKernelDerivative(h, r) })
+		want := -4 / h
+		if math.Abs(got-want) > 1e-2*math.Abs(want) {
+			t.Errorf("h=%v: derivative integrates to %v, want %v", h, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package stream serves the simulation to a browser: a small canvas client
+// and a websocket feed of packed particle frames.
+package stream
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"fluids/core"
+	"fluids/simulation"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Server tracks connected websocket clients and fans frames out to them.
+// Each client has a one-frame queue; a client that can't keep up simply
+// misses frames rather than slowing the simulation.
+type Server struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func NewServer() *Server {
+	return &Server{clients: make(map[chan []byte]struct{})}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+	mux.HandleFunc("/ws", s.serveWebsocket)
+	return mux
+}
+
+// HasClients reports whether anyone is watching, so callers can skip
+// encoding frames entirely when no one is.
+func (s *Server) HasClients() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients) > 0
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := upgrade(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	frames := make(chan []byte, 1)
+	s.mu.Lock()
+	s.clients[frames] = struct{}{}
+	s.mu.Unlock()
+
+	// the client never sends anything we need; reading only detects when it goes away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			opcode, _, err := readFrame(rw)
+			if err != nil || opcode == opClose {
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, frames)
+		s.mu.Unlock()
+		writeFrame(conn, opClose, nil)
+		conn.Close()
+	}()
+	for {
+		select {
+		case frame := <-frames:
+			if err := writeFrame(conn, opBinary, frame); err != nil {
+				if _, ok := err.(net.Error); !ok {
+					log.Println("stream:", err)
+				}
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Broadcast encodes the particles and queues the frame for every client.
+// It returns immediately when no client is connected.
+func (s *Server) Broadcast(particles []core.Particle, domain simulation.Domain, meanPressure, stdPressure float64) {
+	if !s.HasClients() {
+		return
+	}
+	frame := EncodeFrame(particles, domain, meanPressure, stdPressure)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		// drop any stale frame the client hasn't picked up yet
+		select {
+		case <-client:
+		default:
+		}
+		client <- frame
+	}
+}
+
+// Frame layout, little endian:
+//
+//	uint32  particle count
+//	float32 domain X, domain Y
+//	per particle: float32 x, float32 y, uint8 color index (0-255)
+//
+// Color indices come from the same normalized pressure the window renderer
+// uses, so the client's 256-entry palette matches the blue-white scheme.
+const frameHeaderSize = 12
+const particleRecordSize = 9
+
+func EncodeFrame(particles []core.Particle, domain simulation.Domain, meanPressure, stdPressure float64) []byte {
+	buf := make([]byte, frameHeaderSize+particleRecordSize*len(particles))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(particles)))
+	binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(float32(domain.X)))
+	binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(float32(domain.Y)))
+
+	offset := frameHeaderSize
+	for i := range particles {
+		p := &particles[i]
+		binary.LittleEndian.PutUint32(buf[offset:], math.Float32bits(float32(p.X)))
+		binary.LittleEndian.PutUint32(buf[offset+4:], math.Float32bits(float32(p.Y)))
+		t := simulation.NormalizePressure(p.Pressure, meanPressure, stdPressure)
+		if math.IsNaN(t) {
+			t = 0
+		}
+		buf[offset+8] = byte(t * 255)
+		offset += particleRecordSize
+	}
+	return buf
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fluids/core"
+	"fluids/simulation"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey = %q", got)
+	}
+}
+
+func TestBroadcastWithoutClients(t *testing.T) {
+	s := NewServer()
+	// must not block or panic with nobody listening
+	s.Broadcast([]core.Particle{{X: 1, Y: 2}}, simulation.Domain{X: 10, Y: 10}, 0, 1)
+}
+
+func TestStreamFrame(t *testing.T) {
+	s := NewServer()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest("GET", ts.URL+"/ws", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d", resp.StatusCode)
+	}
+
+	for !s.HasClients() {
+		time.Sleep(time.Millisecond)
+	}
+	particles := []core.Particle{{X: 1, Y: 2, Pressure: 5}, {X: 3, Y: 4, Pressure: -5}}
+	s.Broadcast(particles, simulation.Domain{X: 10, Y: 20}, 0, 1)
+
+	opcode, payload, err := readFrame(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opBinary || len(payload) != frameHeaderSize+2*particleRecordSize {
+		t.Fatalf("got opcode %d with %d bytes", opcode, len(payload))
+	}
+	if n := binary.LittleEndian.Uint32(payload); n != 2 {
+		t.Errorf("count = %d, want 2", n)
+	}
+	if y := math.Float32frombits(binary.LittleEndian.Uint32(payload[8:])); y != 20 {
+		t.Errorf("domain Y = %v, want 20", y)
+	}
+	second := payload[frameHeaderSize+particleRecordSize:]
+	if x := math.Float32frombits(binary.LittleEndian.Uint32(second)); x != 3 {
+		t.Errorf("second particle x = %v, want 3", x)
+	}
+	if high, low := payload[frameHeaderSize+8], second[8]; high <= low {
+		t.Errorf("high pressure color index %d not above low pressure %d", high, low)
+	}
+}
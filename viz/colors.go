@@ -0,0 +1,134 @@
+package viz
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type ColorScheme int
+
+const (
+	BlueWhite ColorScheme = iota // pressure, blue (low) to white (high)
+	Viridis                      // pressure, perceptually uniform
+	Grayscale                    // pressure, black to white
+	Velocity                     // speed, blue (slow) to red (fast)
+	Dye                          // each particle's own dye color
+	Force                        // force magnitude on a log scale, blue (weak) to red (strongest)
+	numColorSchemes
+)
+
+func (c ColorScheme) String() string {
+	switch c {
+	case BlueWhite:
+		return "blue-white"
+	case Viridis:
+		return "viridis"
+	case Grayscale:
+		return "grayscale"
+	case Velocity:
+		return "velocity"
+	case Dye:
+		return "dye"
+	case Force:
+		return "force"
+	}
+	return "unknown"
+}
+
+// Next cycles to the following color scheme.
+func (c ColorScheme) Next() ColorScheme {
+	return (c + 1) % numColorSchemes
+}
+
+// ParseColor reads an opaque color written as hex, "#rrggbb" or "rrggbb".
+func ParseColor(s string) (sdl.Color, error) {
+	var r, g, b uint8
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return sdl.Color{}, fmt.Errorf("color %q: want #rrggbb", s)
+	}
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return sdl.Color{}, fmt.Errorf("color %q: %w", s, err)
+	}
+	return sdl.Color{R: r, G: g, B: b, A: 255}, nil
+}
+
+const colorCacheSize = 256
+
+var (
+	colorCache       [colorCacheSize]sdl.Color
+	colorCacheScheme = ColorScheme(-1)
+)
+
+// viridis control points, sampled evenly from the matplotlib colormap
+var viridisStops = [][3]float64{
+	{68, 1, 84},
+	{59, 82, 139},
+	{33, 145, 140},
+	{94, 201, 98},
+	{253, 231, 37},
+}
+
+var velocityStops = [][3]float64{
+	{30, 60, 200},
+	{240, 240, 240},
+	{220, 40, 30},
+}
+
+func lerpStops(stops [][3]float64, t float64) sdl.Color {
+	pos := t * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		i = len(stops) - 2
+	}
+	f := pos - float64(i)
+	a, b := stops[i], stops[i+1]
+	return sdl.Color{
+		R: uint8(a[0] + (b[0]-a[0])*f),
+		G: uint8(a[1] + (b[1]-a[1])*f),
+		B: uint8(a[2] + (b[2]-a[2])*f),
+		A: 255,
+	}
+}
+
+// initColorCache fills the color lookup table for a scheme. It only does work
+// when the scheme differs from the one the cache was last built for.
+func initColorCache(scheme ColorScheme) {
+	if scheme == colorCacheScheme {
+		return
+	}
+	for i := range colorCache {
+		t := float64(i) / float64(colorCacheSize-1)
+		switch scheme {
+		case Viridis:
+			colorCache[i] = lerpStops(viridisStops, t)
+		case Grayscale:
+			v := uint8(255 * t)
+			colorCache[i] = sdl.Color{R: v, G: v, B: v, A: 255}
+		case Velocity, Force:
+			colorCache[i] = lerpStops(velocityStops, t)
+		default:
+			// Lerp between blue and white
+			v := uint8(255 * t)
+			colorCache[i] = sdl.Color{R: v, G: v, B: 255, A: 255}
+		}
+	}
+	colorCacheScheme = scheme
+}
+
+// colorFor looks up the cached color for a value normalized to [0, 1].
+func colorFor(t float64) sdl.Color {
+	if math.IsNaN(t) {
+		t = 0
+	}
+	i := int(t * (colorCacheSize - 1))
+	if i < 0 {
+		i = 0
+	} else if i >= colorCacheSize {
+		i = colorCacheSize - 1
+	}
+	return colorCache[i]
+}
@@ -0,0 +1,218 @@
+package viz
+
+import (
+	"fluids/core"
+	"fluids/simulation"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// drawEllipse outlines an axis-aligned ellipse, which is what a circle in
+// simulation space becomes when the x and y scales differ.
+func drawEllipse(renderer *sdl.Renderer, centerX, centerY int32, radiusX, radiusY float64) {
+	for theta := 0.0; theta < 2*math.Pi; theta += 0.01 {
+		x := centerX + int32(math.Cos(theta)*radiusX)
+		y := centerY + int32(math.Sin(theta)*radiusY)
+		renderer.DrawPoint(x, y)
+	}
+}
+
+// RenderGrid draws the lines between the neighbor grid's cells, cellSize
+// apart in simulation units from the domain's top-left corner. Each axis is
+// scaled on its own, so the cells stay aligned with the particles even when
+// the domain is stretched to a window of another shape.
+func RenderGrid(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	cellSize float64,
+) {
+	if !(cellSize > 0) {
+		return
+	}
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	renderer.SetDrawColor(50, 50, 70, 255)
+	for x := cellSize; x < domain.X; x += cellSize {
+		px := int32(x * scaleX)
+		renderer.DrawLine(px, 0, px, windowHeight)
+	}
+	for y := cellSize; y < domain.Y; y += cellSize {
+		py := int32(y * scaleY)
+		renderer.DrawLine(0, py, windowWidth, py)
+	}
+}
+
+// RenderCell outlines the neighbor grid cell (cellX, cellY), as the grid's
+// CellOf reports it.
+func RenderCell(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	cellSize float64,
+	cellX, cellY int,
+) {
+	if !(cellSize > 0) {
+		return
+	}
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	left := float64(cellX) * cellSize
+	top := float64(cellY) * cellSize
+	renderer.SetDrawColor(120, 200, 255, 255)
+	renderer.DrawRect(&sdl.Rect{
+		X: int32(left * scaleX),
+		Y: int32(top * scaleY),
+		W: int32(cellSize * scaleX),
+		H: int32(cellSize * scaleY),
+	})
+}
+
+// RenderKernelSupport draws the interaction radius around the cursor and
+// highlights the particles inside it, found through the sim's own grid.
+func RenderKernelSupport(
+	renderer *sdl.Renderer,
+	sim *simulation.FluidSim,
+	mouseX, mouseY, windowWidth, windowHeight int32,
+	particleRadius float64,
+) {
+	scaleX := float64(windowWidth) / sim.Domain.X
+	scaleY := float64(windowHeight) / sim.Domain.Y
+	x := float64(mouseX) / scaleX
+	y := float64(mouseY) / scaleY
+	h := sim.InteractionRadius
+
+	renderer.SetDrawColor(255, 80, 80, 255)
+	drawEllipse(renderer, mouseX, mouseY, h*scaleX, h*scaleY)
+
+	renderer.SetDrawColor(255, 220, 0, 255)
+	for _, i := range sim.Grid.GetNeighborParticles(x, y, nil) {
+		if i >= len(sim.Particles) {
+			continue // removed since the grid was updated
+		}
+		p := sim.Particles[i]
+		dx, dy := p.X-x, p.Y-y
+		if dx*dx+dy*dy < h*h {
+			drawCircle(renderer, int32(p.X*scaleX), int32(p.Y*scaleY), int32(particleRadius))
+		}
+	}
+}
+
+// RenderSegment draws a line between two points given in simulation coordinates.
+func RenderSegment(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	x1, y1, x2, y2 float64,
+) {
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	renderer.SetDrawColor(0, 255, 160, 255)
+	renderer.DrawLine(int32(x1*scaleX), int32(y1*scaleY), int32(x2*scaleX), int32(y2*scaleY))
+}
+
+// RenderPiston draws the piston plate as a bar across the window with its
+// lower edge at the plate's height.
+func RenderPiston(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	piston *simulation.Piston,
+) {
+	const thickness = 4
+	y := int32(piston.Y * float64(windowHeight) / domain.Y)
+	renderer.SetDrawColor(180, 180, 190, 255)
+	renderer.FillRect(&sdl.Rect{X: 0, Y: y - thickness, W: windowWidth, H: thickness})
+}
+
+// RenderSelection rings the selected particle in magenta, a little larger
+// than the particle itself.
+func RenderSelection(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	particle *core.Particle,
+	particleRadius float64,
+) {
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	radius := particleRadius*math.Sqrt(particle.Mass) + 3
+	renderer.SetDrawColor(255, 0, 255, 255)
+	drawEllipse(renderer, int32(particle.X*scaleX), int32(particle.Y*scaleY), radius, radius)
+}
+
+// RenderObstacle outlines the wind tunnel's obstacle.
+func RenderObstacle(
+	renderer *sdl.Renderer,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	obstacle *simulation.Obstacle,
+) {
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	renderer.SetDrawColor(180, 180, 190, 255)
+	drawEllipse(renderer, int32(obstacle.X*scaleX), int32(obstacle.Y*scaleY), obstacle.Radius*scaleX, obstacle.Radius*scaleY)
+}
+
+// RenderHistogram draws bar counts in the bottom-right corner, scaled so the
+// tallest bar fills the panel. The last bar, where the fast tail collects, is
+// red.
+func RenderHistogram(renderer *sdl.Renderer, windowWidth, windowHeight int32, counts []int) {
+	const barWidth, panelHeight, margin = 6, 60, 10
+	if len(counts) == 0 {
+		return
+	}
+	peak := 0
+	for _, c := range counts {
+		if c > peak {
+			peak = c
+		}
+	}
+	left := windowWidth - margin - barWidth*int32(len(counts))
+	bottom := windowHeight - margin
+
+	renderer.SetDrawColor(30, 30, 30, 255)
+	renderer.FillRect(&sdl.Rect{X: left - 2, Y: bottom - panelHeight - 2, W: barWidth*int32(len(counts)) + 4, H: panelHeight + 4})
+	if peak == 0 {
+		return
+	}
+	for b, c := range counts {
+		height := int32(c * panelHeight / peak)
+		if b == len(counts)-1 {
+			renderer.SetDrawColor(230, 60, 60, 255)
+		} else {
+			renderer.SetDrawColor(200, 200, 200, 255)
+		}
+		renderer.FillRect(&sdl.Rect{X: left + int32(b)*barWidth, Y: bottom - height, W: barWidth - 1, H: height})
+	}
+}
+
+// RenderBlast outlines a mouse blast's radius and rings the particles it
+// kicked in orange, wherever they have moved since; particles inside the
+// circle without a ring were missed.
+func RenderBlast(
+	renderer *sdl.Renderer,
+	particles []core.Particle,
+	domain simulation.Domain,
+	windowWidth, windowHeight int32,
+	x, y, radius float64,
+	kicked []int,
+	particleRadius float64,
+) {
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	renderer.SetDrawColor(255, 80, 80, 255)
+	drawEllipse(renderer, int32(x*scaleX), int32(y*scaleY), radius*scaleX, radius*scaleY)
+
+	hit := make(map[int]bool, len(kicked))
+	for _, id := range kicked {
+		hit[id] = true
+	}
+	renderer.SetDrawColor(255, 150, 0, 255)
+	for i := range particles {
+		if p := &particles[i]; hit[p.ID] {
+			drawCircle(renderer, int32(p.X*scaleX), int32(p.Y*scaleY), int32(particleRadius*math.Sqrt(p.Mass)+2))
+		}
+	}
+}
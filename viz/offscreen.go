@@ -0,0 +1,59 @@
+package viz
+
+import (
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// NewOffscreen creates a software renderer that draws into a width x height
+// surface in memory, so frames can be rendered with no window, display, or
+// GPU. RenderFrame and the overlays work on it unchanged.
+func NewOffscreen(width, height int32) (*sdl.Renderer, *sdl.Surface, error) {
+	surface, err := sdl.CreateRGBSurfaceWithFormat(0, width, height, 32, uint32(sdl.PIXELFORMAT_RGBA32))
+	if err != nil {
+		return nil, nil, err
+	}
+	renderer, err := sdl.CreateSoftwareRenderer(surface)
+	if err != nil {
+		surface.Free()
+		return nil, nil, err
+	}
+	return renderer, surface, nil
+}
+
+// SurfaceImage copies the pixels of a surface made by NewOffscreen, whose
+// RGBA32 format is byte for byte the layout of image.RGBA.
+func SurfaceImage(surface *sdl.Surface) (*image.RGBA, error) {
+	if err := surface.Lock(); err != nil {
+		return nil, err
+	}
+	defer surface.Unlock()
+
+	img := image.NewRGBA(image.Rect(0, 0, int(surface.W), int(surface.H)))
+	pixels := surface.Pixels()
+	pitch := int(surface.Pitch)
+	for y := 0; y < int(surface.H); y++ {
+		copy(img.Pix[y*img.Stride:(y+1)*img.Stride], pixels[y*pitch:])
+	}
+	return img, nil
+}
+
+// SaveSurfacePNG writes a surface made by NewOffscreen to a PNG file.
+func SaveSurfacePNG(surface *sdl.Surface, path string) error {
+	img, err := SurfaceImage(surface)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -8,12 +8,18 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// size of the window, and of offscreen frames
+const (
+	WindowWidth  = 1200
+	WindowHeight = 800
+)
+
 func NewWindow() (*sdl.Renderer, *sdl.Window, error) {
 	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
 		return nil, nil, err
 	}
 
-	window, err := sdl.CreateWindow("Fluid Simulation", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, 1200, 800, sdl.WINDOW_SHOWN)
+	window, err := sdl.CreateWindow("Fluid Simulation", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, WindowWidth, WindowHeight, sdl.WINDOW_SHOWN)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -26,19 +32,209 @@ func NewWindow() (*sdl.Renderer, *sdl.Window, error) {
 	return renderer, window, nil
 }
 
-func sigmoid(x float64) float64 {
-	return 1.0 / (1.0 + math.Exp(-x))
+// SetStatus shows simulation state in the window title, which serves as the
+// debug panel since the renderer draws no text.
+func SetStatus(window *sdl.Window, status string) {
+	window.SetTitle("Fluid Simulation - " + status)
 }
 
+// drawCircle outlines a circle, plotting each pixel once. The angular sweep
+// lands on the same pixel many times for small radii, which would otherwise
+// stack up under additive blending.
 func drawCircle(renderer *sdl.Renderer, centerX, centerY, radius int32) {
-	for theta := 0.0; theta < 2*math.Pi; theta += 0.01 {
-		x := centerX + int32(math.Cos(theta)*float64(radius))
-		y := centerY + int32(math.Sin(theta)*float64(radius))
-		renderer.DrawPoint(x, y)
+	for _, o := range circleOutline(radius) {
+		renderer.DrawPoint(centerX+o.X, centerY+o.Y)
+	}
+}
+
+// circleOutlines caches the pixels of each radius's outline as offsets from
+// the center. Rounding to pixels doesn't depend on where the center is, so
+// the sweep only has to run once per radius.
+var circleOutlines = map[int32][]sdl.Point{}
+
+func circleOutline(radius int32) []sdl.Point {
+	if outline, ok := circleOutlines[radius]; ok {
+		return outline
+	}
+	first := sdl.Point{X: radius}
+	last := first
+	outline := []sdl.Point{first}
+	for theta := 0.01; theta < 2*math.Pi; theta += 0.01 {
+		p := sdl.Point{X: int32(math.Cos(theta) * float64(radius)), Y: int32(math.Sin(theta) * float64(radius))}
+		if p == last || p == first {
+			continue
+		}
+		outline = append(outline, p)
+		last = p
+	}
+	circleOutlines[radius] = outline
+	return outline
+}
+
+// particleBatch collects the outline pixels of every particle drawn in one
+// color, so the whole batch goes to the renderer in a single DrawPoints call
+// instead of a call per pixel.
+type particleBatch struct {
+	color  sdl.Color
+	points []sdl.Point
+}
+
+// particleBatches holds the batches between frames so their point slices are
+// reused; batchIndex finds a color's batch.
+var (
+	particleBatches []particleBatch
+	batchIndex      = map[sdl.Color]int{}
+)
+
+// addToBatch adds a particle's outline to the batch for its color.
+func addToBatch(color sdl.Color, centerX, centerY, radius int32) {
+	b, ok := batchIndex[color]
+	if !ok {
+		b = len(batchIndex)
+		batchIndex[color] = b
+		if b == len(particleBatches) {
+			particleBatches = append(particleBatches, particleBatch{})
+		}
+		particleBatches[b].color = color
+		particleBatches[b].points = particleBatches[b].points[:0]
+	}
+	batch := &particleBatches[b]
+	for _, o := range circleOutline(radius) {
+		batch.points = append(batch.points, sdl.Point{X: centerX + o.X, Y: centerY + o.Y})
 	}
 }
 
-// renders a single frame
+// flushBatches draws every batch, one call per color, and empties them.
+func flushBatches(renderer *sdl.Renderer) {
+	for b := range batchIndex {
+		delete(batchIndex, b)
+	}
+	for i := range particleBatches {
+		batch := &particleBatches[i]
+		if len(batch.points) == 0 {
+			continue
+		}
+		renderer.SetDrawColor(batch.color.R, batch.color.G, batch.color.B, batch.color.A)
+		renderer.DrawPoints(batch.points)
+		batch.points = batch.points[:0]
+	}
+}
+
+// RenderStyle controls how the particle pass is composited.
+type RenderStyle struct {
+	Background sdl.Color
+	// Additive blends particles so overlaps brighten, for a glowing look.
+	// Particles are drawn at additiveAlpha so a lone particle keeps its hue.
+	Additive bool
+	// PressureSize scales each dot by its normalized pressure, from
+	// minPressureSize to maxPressureSize of its usual radius, on top of
+	// whatever the color scheme shows.
+	PressureSize bool
+	// Letterbox draws the domain at a uniform scale, centered with bars in
+	// the margins, instead of stretching it to fill the window.
+	Letterbox bool
+	// DensityAlpha fades particles by density: those at or above the mean
+	// density of the frame are opaque and sparser ones, at the edges of the
+	// fluid and in spray, fade toward minDensityAlpha. The color scheme
+	// still picks the color.
+	DensityAlpha bool
+	// NeighborMesh draws a line from each particle to its neighbors, under
+	// the particles. NeighborDrawLimit keeps only each particle's closest
+	// few, so dense fluid reads as a mesh rather than a solid tangle of
+	// lines; 0 draws every neighbor.
+	NeighborMesh      bool
+	NeighborDrawLimit int
+}
+
+// meshColor is the color of the NeighborMesh lines, dim so the particles
+// stand out on top of them.
+var meshColor = sdl.Color{R: 60, G: 80, B: 110, A: 255}
+
+// renderNeighborMesh draws the lines of the NeighborMesh style.
+func renderNeighborMesh(renderer *sdl.Renderer, particles []core.Particle, scaleX, scaleY float64, limit int) {
+	renderer.SetDrawColor(meshColor.R, meshColor.G, meshColor.B, meshColor.A)
+	var near []core.Vector
+	for i := range particles {
+		p := &particles[i]
+		near = simulation.ClosestNeighbors(p, limit, near[:0])
+		x, y := int32(p.X*scaleX), int32(p.Y*scaleY)
+		for _, n := range near {
+			renderer.DrawLine(x, y, int32(n.X*scaleX), int32(n.Y*scaleY))
+		}
+	}
+}
+
+// dot size bounds under PressureSize; mean pressure keeps the usual size, and
+// the cap keeps the highest pressures from swelling into blobs
+const (
+	minPressureSize = 0.5
+	maxPressureSize = 1.5
+)
+
+// lifeFade is the final fraction of a finite lifetime over which a particle
+// fades out.
+const lifeFade = 0.3
+
+// lifeAlpha is the opacity factor of a particle of the given age and
+// lifetime: 1 until the last lifeFade of its life, then falling linearly to
+// 0 as it expires. Particles that live forever stay opaque.
+func lifeAlpha(age, maxAge float64) float64 {
+	if maxAge <= 0 {
+		return 1
+	}
+	return math.Max(0, math.Min(1, (maxAge-age)/(lifeFade*maxAge)))
+}
+
+// pressureSize maps a normalized pressure to a radius factor in
+// [minPressureSize, maxPressureSize]. Undefined pressures (no spread in the
+// frame) keep the usual size.
+func pressureSize(t float64) float64 {
+	if math.IsNaN(t) {
+		return 1
+	}
+	t = math.Max(0, math.Min(1, t))
+	return minPressureSize + (maxPressureSize-minPressureSize)*t
+}
+
+// opacity of a particle with no density at all under DensityAlpha, as a
+// fraction, so isolated particles stay faintly visible
+const minDensityAlpha = 0.15
+
+// densityAlpha maps a density to an opacity in [minDensityAlpha, 1], linear
+// in the density up to the mean.
+func densityAlpha(density, meanDensity float64) float64 {
+	if !(meanDensity > 0) {
+		return 1
+	}
+	t := math.Max(0, math.Min(1, density/meanDensity))
+	return minDensityAlpha + (1-minDensityAlpha)*t
+}
+
+// additiveAlpha scales particle colors under additive blending, leaving
+// headroom for overlaps before channels saturate to white.
+const additiveAlpha = 140
+
+func DefaultRenderStyle() RenderStyle {
+	return RenderStyle{Background: sdl.Color{R: 0, G: 0, B: 0, A: 255}, Letterbox: true}
+}
+
+// color of the letterbox bars, a shade off black so the domain's edges show
+var letterboxColor = sdl.Color{R: 24, G: 24, B: 24, A: 255}
+
+// Letterbox fits a domain into a width by height area at the largest uniform
+// scale, centered, so a square domain draws as a square whatever the shape
+// of the window. It returns the domain's rectangle within the area.
+func Letterbox(width, height int32, domain simulation.Domain) sdl.Rect {
+	scale := math.Min(float64(width)/domain.X, float64(height)/domain.Y)
+	w, h := int32(domain.X*scale), int32(domain.Y*scale)
+	return sdl.Rect{X: (width - w) / 2, Y: (height - h) / 2, W: w, H: h}
+}
+
+// renders a single frame; the caller draws any overlays and then presents.
+// The blend mode is restored to none afterwards so overlays draw opaque.
+// With style.Letterbox the margins are filled with bars and the viewport is
+// left narrowed to the domain's Letterbox rectangle, so overlays line up when
+// drawn with that rectangle's size; reset the viewport before the next frame.
 func RenderFrame(
 	renderer *sdl.Renderer,
 	particles []core.Particle,
@@ -47,33 +243,116 @@ func RenderFrame(
 	particleRadius float64,
 	meanPressure float64,
 	stdPressure float64,
+	colorScheme ColorScheme,
+	style RenderStyle,
 ) {
+	initColorCache(colorScheme)
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	if style.Letterbox {
+		area := renderer.GetViewport()
+		renderer.SetDrawColor(letterboxColor.R, letterboxColor.G, letterboxColor.B, 255)
+		renderer.FillRect(nil)
+		view := Letterbox(windowWidth, windowHeight, domain)
+		view.X += area.X
+		view.Y += area.Y
+		renderer.SetViewport(&view)
+		windowWidth, windowHeight = view.W, view.H
+	}
+
 	// Clear the screen
-	renderer.SetDrawColor(0, 0, 0, 255)
-	renderer.Clear()
+	bg := style.Background
+	renderer.SetDrawColor(bg.R, bg.G, bg.B, 255)
+	// filling rather than clearing stays inside the viewport, so several
+	// sims can be drawn side by side in one window
+	renderer.FillRect(nil)
 
 	// Define scaling factors based on window size and domain size
 	scaleX := float32(windowWidth) / float32(domain.X)
 	scaleY := float32(windowHeight) / float32(domain.Y)
 
+	if style.NeighborMesh {
+		renderNeighborMesh(renderer, particles, float64(scaleX), float64(scaleY), style.NeighborDrawLimit)
+	}
+
+	alpha := uint8(255)
+	if style.Additive {
+		renderer.SetDrawBlendMode(sdl.BLENDMODE_ADD)
+		alpha = additiveAlpha
+	} else {
+		// opaque particles draw the same blended or not, and blending lets
+		// DensityAlpha and short-lived particles fade
+		renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	}
+	defer renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	meanDensity := 0.0
+	if style.DensityAlpha && len(particles) > 0 {
+		for _, particle := range particles {
+			meanDensity += particle.Density
+		}
+		meanDensity /= float64(len(particles))
+	}
+
+	// the velocity scheme colors by speed relative to the fastest particle
+	maxSpeed := 0.0
+	if colorScheme == Velocity {
+		for _, particle := range particles {
+			maxSpeed = math.Max(maxSpeed, math.Hypot(particle.Vx, particle.Vy))
+		}
+	}
+
+	// the force scheme colors by force relative to the strongest, computed
+	// before the step integrated it, so a blow-up shows where it starts
+	var meanForce, peakForce float64
+	if colorScheme == Force {
+		meanForce, peakForce, _ = simulation.ForceStats(particles)
+	}
+
 	// Draw particles based on fluid pressures
 	for _, particle := range particles {
-		// Normalize pressure using sigmoid function
-		normalizedPressure := sigmoid((particle.Pressure - meanPressure) / stdPressure)
-
-		// Lerp between blue and white based on normalized pressure
-		r := uint8(255 * normalizedPressure)
-		g := uint8(255 * normalizedPressure)
-		b := uint8(255*(1-normalizedPressure) + normalizedPressure*255)
-		renderer.SetDrawColor(r, g, b, 255)
+		var t float64
+		if colorScheme == Velocity {
+			if maxSpeed > 0 {
+				t = math.Hypot(particle.Vx, particle.Vy) / maxSpeed
+			}
+		} else if colorScheme == Force {
+			t = simulation.NormalizeForce(math.Hypot(particle.Force.X, particle.Force.Y), meanForce, peakForce)
+		} else {
+			t = simulation.NormalizePressure(particle.Pressure, meanPressure, stdPressure)
+		}
+		color := colorFor(t)
+		if colorScheme == Dye {
+			color = sdl.Color{R: particle.R, G: particle.G, B: particle.B, A: 255}
+		}
+		a := alpha
+		if style.DensityAlpha {
+			a = uint8(float64(alpha) * densityAlpha(particle.Density, meanDensity))
+		}
+		if particle.MaxAge > 0 {
+			a = uint8(float64(a) * lifeAlpha(particle.Age, particle.MaxAge))
+		}
+		color.A = a
 
 		// Scale particle positions
 		x := int32(particle.X * float64(scaleX))
 		y := int32(particle.Y * float64(scaleY))
 
-		// Draw circle with radius
-		drawCircle(renderer, x, y, int32(particleRadius))
+		// Draw circle with radius, scaled by the particle's size relative to
+		// the base radius (mass goes as radius squared)
+		radius := particleRadius * math.Sqrt(particle.Mass)
+		if style.PressureSize {
+			radius *= pressureSize(simulation.NormalizePressure(particle.Pressure, meanPressure, stdPressure))
+		}
+		addToBatch(color, x, y, int32(math.Max(radius, 1)))
 	}
+	flushBatches(renderer)
 
-	renderer.Present()
+	if domain.Shape == simulation.Circle {
+		renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+		renderer.SetDrawColor(120, 120, 120, 255)
+		cx, cy := domain.Center()
+		drawEllipse(renderer, int32(cx*float64(scaleX)), int32(cy*float64(scaleY)),
+			domain.Radius*float64(scaleX), domain.Radius*float64(scaleY))
+	}
 }
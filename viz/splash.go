@@ -0,0 +1,70 @@
+package viz
+
+import (
+	"fluids/simulation"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	splashFrames   = 18  // frames a splash ring lives
+	maxSplashRings = 32  // rings alive at once; further splashes are dropped
+	splashSpacing  = 3.0 // simulation units a new splash must be from any ring still growing
+	splashGrowth   = 1.5 // pixels a ring's radius grows per frame
+)
+
+type splashRing struct {
+	x, y float64 // simulation coordinates
+	age  int     // frames since the impact
+}
+
+// SplashEffects draws a brief expanding, fading ring where fast particles
+// hit a wall. It throttles on top of the sim's own per-step cap: a splash
+// close to a ring that is still young is merged into it, and no more than
+// maxSplashRings are alive at once, so a wave breaking on a wall flashes a
+// few times instead of spawning thousands of rings.
+type SplashEffects struct {
+	rings []splashRing
+}
+
+// Add starts rings for the given splashes, skipping those the throttle
+// rejects.
+func (s *SplashEffects) Add(splashes []simulation.Splash) {
+	for _, splash := range splashes {
+		if len(s.rings) >= maxSplashRings {
+			return
+		}
+		merged := false
+		for _, r := range s.rings {
+			if r.age < splashFrames/2 && math.Hypot(r.x-splash.X, r.y-splash.Y) < splashSpacing {
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			s.rings = append(s.rings, splashRing{x: splash.X, y: splash.Y})
+		}
+	}
+}
+
+// Render draws every live ring and ages it by a frame, dropping rings that
+// have faded out.
+func (s *SplashEffects) Render(renderer *sdl.Renderer, domain simulation.Domain, windowWidth, windowHeight int32) {
+	scaleX := float64(windowWidth) / domain.X
+	scaleY := float64(windowHeight) / domain.Y
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	defer renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	live := s.rings[:0]
+	for _, r := range s.rings {
+		fade := 1 - float64(r.age)/splashFrames
+		renderer.SetDrawColor(255, 255, 255, uint8(255*fade))
+		drawCircle(renderer, int32(r.x*scaleX), int32(r.y*scaleY), int32(2+splashGrowth*float64(r.age)))
+		r.age++
+		if r.age < splashFrames {
+			live = append(live, r)
+		}
+	}
+	s.rings = live
+}